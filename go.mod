@@ -2,4 +2,7 @@ module github.com/siavash-art/wallet
 
 go 1.15
 
-require github.com/google/uuid v1.1.2
+require (
+	github.com/google/uuid v1.1.2
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+)
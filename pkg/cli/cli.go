@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/siavash-art/wallet/pkg/config"
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+// Exit codes of Run
+const (
+	ExitOK     = 0
+	ExitError  = 1
+	ExitUsage  = 2
+	ExitConfig = 3
+)
+
+var errUsage = errors.New("usage")
+
+// env is the state shared by commands, svc is loaded from dataDir before
+// the command runs and written back after commands which change it, in the
+// shell changes are only marked as unsaved until the save command
+type env struct {
+	config  config.Config
+	dataDir string
+	json    bool
+	svc     *wallet.Service
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	shell   bool
+	unsaved bool
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	mutates bool
+	run     func(e *env, args []string) (interface{}, error)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"register", "<phone>", "register account", true, runRegister},
+		{"deposit", "<account> <amount>", "deposit account", true, runDeposit},
+		{"pay", "<account> <amount> <category> [pin] [otp]", "make payment, pin confirms it", true, runPay},
+		{"reject", "<payment>", "reject payment", true, runReject},
+		{"repeat", "<payment>", "repeat payment", true, runRepeat},
+		{"favorite add", "<payment> <name>", "add payment to favorites", true, runFavoriteAdd},
+		{"favorite pay", "<favorite> [amount]", "pay from favorite", true, runFavoritePay},
+		{"favorite list", "<account>", "list favorites of account", false, runFavoriteList},
+		{"budget set", "<account> <category> <amount> [hard] [thresholds like 50,80,100]", "set monthly budget of category", true, runBudgetSet},
+		{"budget remove", "<account> <category>", "remove budget of category", true, runBudgetRemove},
+		{"budget status", "<account>", "show spending of budgets in this month", false, runBudgetStatus},
+		{"category add", "<id> <name> [parent|-] [aliases like eat,meal]", "register category or replace it", true, runCategoryAdd},
+		{"category list", "", "list registered categories", false, runCategoryList},
+		{"category migrate", "", "rewrite free text categories to registered ones", true, runCategoryMigrate},
+		{"merchant add", "<name> <category> <settlement account>", "register merchant", true, runMerchantAdd},
+		{"merchant list", "", "list merchants with balances", false, runMerchantList},
+		{"merchant pay", "<account> <merchant> <amount>", "pay merchant from account", true, runMerchantPay},
+		{"merchant payments", "<merchant>", "list payments to merchant", false, runMerchantPayments},
+		{"merchant settle", "<merchant>", "move balance of merchant to its settlement account", true, runMerchantSettle},
+		{"merchant report", "<merchant>", "show payments, refunds and settlements of merchant", false, runMerchantReport},
+		{"refund", "<payment> <amount>", "refund part of payment", true, runRefund},
+		{"account", "<account>", "show account", false, runAccount},
+		{"find", "<account|phone>", "find account by id or phone", false, runFind},
+		{"history", "<account> [order]", "list payments of account, order is amount, category, id or created, - before it sorts descending", false, runHistory},
+		{"report", "<account> [day|week|month] [file.csv|file.json]", "spending by category and period, written to file if given", false, runReport},
+		{"sum", "[goroutines]", "sum of all payments", false, runSum},
+		{"export", "<dir>", "write data to dump files in dir", false, runExport},
+		{"import", "<dir>", "replace data with dump files from dir", true, runImport},
+		{"serve", "[-addr address]", "serve REST API", false, runServe},
+		{"shell", "", "explore data interactively, changes are written by save", false, runShell},
+	}
+}
+
+// Run executes command line args like "-data dir -json pay 1 100 food" and
+// returns exit code: ExitUsage for wrong arguments, ExitConfig for wrong
+// configuration and ExitError for errors of service
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	e := &env{stdin: os.Stdin, stdout: stdout, stderr: stderr}
+	configPath := flags.String("config", os.Getenv("WALLET_CONFIG"), "JSON config file, WALLET_* variables override it")
+	flags.StringVar(&e.dataDir, "data", "", "directory of dump files, overrides config")
+	flags.BoolVar(&e.json, "json", false, "print results as JSON")
+	flags.Usage = func() {
+		usage(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	cfg, err := config.Load(*configPath, os.Getenv)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitConfig
+	}
+	e.config = cfg
+	if e.dataDir == "" {
+		e.dataDir = cfg.DataDir
+	}
+
+	e.svc = &wallet.Service{}
+	if err := cfg.Apply(e.svc); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitConfig
+	}
+	if err := e.svc.Import(e.dataDir); err != nil {
+		e.printError(err)
+		return ExitError
+	}
+	return e.exec(flags.Args())
+}
+
+// exec runs the command and prints its result
+func (e *env) exec(args []string) int {
+	cmd, rest, ok := findCommand(e.commands(), args)
+	if !ok {
+		fmt.Fprintf(e.stderr, "unknown command %q\n", strings.Join(args, " "))
+		if !e.shell {
+			usage(e.stderr)
+		}
+		return ExitUsage
+	}
+
+	result, err := cmd.run(e, rest)
+	if errors.Is(err, errUsage) {
+		if err != errUsage {
+			fmt.Fprintln(e.stderr, err)
+		}
+		fmt.Fprintf(e.stderr, "usage: wallet %s %s\n", cmd.name, cmd.args)
+		return ExitUsage
+	}
+	if err == nil && cmd.mutates {
+		if e.shell {
+			e.unsaved = true
+		} else {
+			err = e.save()
+		}
+	}
+	if err != nil {
+		e.printError(err)
+		return ExitError
+	}
+	if result != nil {
+		e.print(result)
+	}
+	return ExitOK
+}
+
+// findCommand finds command by one or two words, like "pay" or "favorite add"
+func findCommand(list []command, args []string) (command, []string, bool) {
+	for _, cmd := range list {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: wallet [-config file] [-data dir] [-json] <command> [arguments]")
+	printCommands(w, commands)
+}
+
+func printCommands(w io.Writer, list []command) {
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range list {
+		fmt.Fprintf(w, "  %-32s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+}
+
+// save writes service to data directory
+func (e *env) save() error {
+	if err := os.MkdirAll(e.dataDir, 0777); err != nil {
+		return err
+	}
+	return e.svc.Export(e.dataDir)
+}
+
+func (e *env) print(result interface{}) {
+	if e.json {
+		encoder := json.NewEncoder(e.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
+	}
+
+	switch value := result.(type) {
+	case *types.Account:
+		fmt.Fprintf(e.stdout, "account %d phone %s balance %d held %d status %s\n", value.ID, value.Phone, value.Balance, value.Held, value.Status)
+	case *types.Payment:
+		printPayment(e.stdout, *value)
+	case []types.Payment:
+		for _, payment := range value {
+			printPayment(e.stdout, payment)
+		}
+	case *types.Refund:
+		fmt.Fprintf(e.stdout, "refund %s payment %s account %d amount %d\n", value.ID, value.PaymentID, value.AccountID, value.Amount)
+	case *types.Favorite:
+		printFavorite(e.stdout, *value)
+	case []types.Favorite:
+		for _, favorite := range value {
+			printFavorite(e.stdout, favorite)
+		}
+	case *types.Budget:
+		fmt.Fprintf(e.stdout, "budget account %d category %s amount %d thresholds %v hard %v\n", value.AccountID, value.Category, value.Amount, value.Thresholds, value.Hard)
+	case []types.BudgetStatus:
+		for _, status := range value {
+			fmt.Fprintf(e.stdout, "budget category %s month %s spent %d of %d remaining %d reached %v hard %v\n", status.Category, status.Month, status.Spent, status.Amount, status.Remaining, status.Reached, status.Hard)
+		}
+	case *types.Category:
+		printCategory(e.stdout, *value)
+	case []types.Category:
+		for _, category := range value {
+			printCategory(e.stdout, category)
+		}
+	case *types.Merchant:
+		printMerchant(e.stdout, *value)
+	case []types.Merchant:
+		for _, merchant := range value {
+			printMerchant(e.stdout, merchant)
+		}
+	case *types.Settlement:
+		fmt.Fprintf(e.stdout, "settlement %s merchant %s account %d amount %d\n", value.ID, value.MerchantID, value.AccountID, value.Amount)
+	case types.SettlementReport:
+		fmt.Fprintf(e.stdout, "merchant %s payments %d gross %d refunded %d net %d settled %d balance %d\n", value.MerchantID, value.Count, value.Gross, value.Refunded, value.Net, value.Settled, value.Balance)
+	case types.CategoryMigration:
+		fmt.Fprintf(e.stdout, "categories changed %d unresolved %v\n", value.Changed, value.Unresolved)
+	case types.Report:
+		for _, row := range value.Rows {
+			if row.Period != "" {
+				fmt.Fprintf(e.stdout, "%s ", row.Period)
+			}
+			fmt.Fprintf(e.stdout, "category %s total %d count %d share %.1f%%\n", row.Category, row.Total, row.Count, row.Share*100)
+		}
+		fmt.Fprintf(e.stdout, "total %d count %d\n", value.Total, value.Count)
+	default:
+		fmt.Fprintln(e.stdout, value)
+	}
+}
+
+func printPayment(w io.Writer, payment types.Payment) {
+	fmt.Fprintf(w, "payment %s account %d amount %d category %s status %s\n", payment.ID, payment.AccountID, payment.Amount, payment.Category, payment.Status)
+}
+
+func printFavorite(w io.Writer, favorite types.Favorite) {
+	fmt.Fprintf(w, "favorite %s account %d name %q amount %d category %s\n", favorite.ID, favorite.AccountID, favorite.Name, favorite.Amount, favorite.Category)
+}
+
+func printMerchant(w io.Writer, merchant types.Merchant) {
+	fmt.Fprintf(w, "merchant %s name %q category %s settlement account %d balance %d\n", merchant.ID, merchant.Name, merchant.Category, merchant.SettlementAccountID, merchant.Balance)
+}
+
+func printCategory(w io.Writer, category types.Category) {
+	fmt.Fprintf(w, "category %s name %q parent %s aliases %v\n", category.ID, category.Name, category.Parent, category.Aliases)
+}
+
+// printError prints error, in JSON mode with its kind
+func (e *env) printError(err error) {
+	if e.json {
+		json.NewEncoder(e.stderr).Encode(map[string]string{"error": err.Error(), "kind": wallet.KindOf(err).String()})
+		return
+	}
+	fmt.Fprintf(e.stderr, "error: %v\n", err)
+}
+
+func parseAccountID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid account %q", errUsage, value)
+	}
+	return id, nil
+}
+
+func parseAmount(value string) (types.Money, error) {
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid amount %q", errUsage, value)
+	}
+	return types.Money(amount), nil
+}
@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+// run runs command on data directory and returns exit code with output
+func run(dir string, args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := Run(append([]string{"-data", dir}, args...), stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_payments(t *testing.T) {
+	dir := t.TempDir()
+
+	code, out, errOut := run(dir, "register", "+992938638676")
+	if code != ExitOK || !strings.Contains(out, "account 1") {
+		t.Errorf("register: code = %v, out = %q, err = %q", code, out, errOut)
+		return
+	}
+	code, out, _ = run(dir, "deposit", "1", "1000000")
+	if code != ExitOK || !strings.Contains(out, "balance 1000000") {
+		t.Errorf("deposit: code = %v, out = %q", code, out)
+	}
+
+	payment := types.Payment{}
+	code, out, _ = run(dir, "-json", "pay", "1", "100000", "cat")
+	if code != ExitOK {
+		t.Errorf("pay: code = %v, out = %q", code, out)
+		return
+	}
+	if err := json.Unmarshal([]byte(out), &payment); err != nil || payment.Amount != 100000 {
+		t.Errorf("pay: payment = %v, error = %v", payment, err)
+		return
+	}
+
+	favorite := types.Favorite{}
+	_, out, _ = run(dir, "-json", "favorite", "add", payment.ID, "cat food")
+	if err := json.Unmarshal([]byte(out), &favorite); err != nil || favorite.Name != "cat food" {
+		t.Errorf("favorite add: favorite = %v, error = %v", favorite, err)
+		return
+	}
+	code, out, _ = run(dir, "favorite", "pay", favorite.ID, "50000")
+	if code != ExitOK || !strings.Contains(out, "amount 50000") {
+		t.Errorf("favorite pay: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "favorite", "list", "1")
+	if code != ExitOK || strings.Count(out, "favorite ") != 1 {
+		t.Errorf("favorite list: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "reject", payment.ID)
+	if code != ExitOK || !strings.Contains(out, "status FAIL") {
+		t.Errorf("reject: code = %v, out = %q", code, out)
+	}
+
+	payments := []types.Payment{}
+	_, out, _ = run(dir, "-json", "history", "1")
+	if err := json.Unmarshal([]byte(out), &payments); err != nil || len(payments) != 2 {
+		t.Errorf("history: payments = %v, error = %v", payments, err)
+	}
+	code, out, _ = run(dir, "history", "1", "-amount")
+	if code != ExitOK || strings.Index(out, "amount 100000") > strings.Index(out, "amount 50000") {
+		t.Errorf("history -amount: code = %v, out = %q", code, out)
+	}
+	code, _, errOut = run(dir, "history", "1", "date")
+	if code != ExitError || !strings.Contains(errOut, "invalid payment order") {
+		t.Errorf("history date: code = %v, err = %q", code, errOut)
+	}
+	code, out, _ = run(dir, "report", "1", "month")
+	if code != ExitOK || !strings.Contains(out, "category cat total 50000 count 1 share 100.0%") {
+		t.Errorf("report: code = %v, out = %q", code, out)
+	}
+	csvPath := filepath.Join(t.TempDir(), "report.csv")
+	code, _, _ = run(dir, "report", "1", "month", csvPath)
+	if data, err := ioutil.ReadFile(csvPath); code != ExitOK || err != nil || !strings.HasPrefix(string(data), "period,category") {
+		t.Errorf("report csv: code = %v, data = %q, error = %v", code, data, err)
+	}
+	code, out, _ = run(dir, "budget", "set", "1", "cat", "60000", "hard", "50,100")
+	if code != ExitOK || !strings.Contains(out, "thresholds [50 100] hard true") {
+		t.Errorf("budget set: code = %v, out = %q", code, out)
+	}
+	code, _, errOut = run(dir, "pay", "1", "10001", "cat")
+	if code != ExitError || !strings.Contains(errOut, "hard budget") {
+		t.Errorf("pay: hard budget must block payment, code = %v, err = %q", code, errOut)
+	}
+	code, out, _ = run(dir, "budget", "status", "1")
+	if code != ExitOK || !strings.Contains(out, "spent 50000 of 60000 remaining 10000 reached [50]") {
+		t.Errorf("budget status: code = %v, out = %q", code, out)
+	}
+	code, _, _ = run(dir, "budget", "remove", "1", "cat")
+	if code != ExitOK {
+		t.Errorf("budget remove: code = %v", code)
+	}
+	code, out, _ = run(dir, "sum", "2")
+	if code != ExitOK || strings.TrimSpace(out) != "150000" {
+		t.Errorf("sum: code = %v, out = %q", code, out)
+	}
+
+	run(dir, "register", "+992938638677")
+	merchant := types.Merchant{}
+	_, out, _ = run(dir, "-json", "merchant", "add", "Pet Shop", "cat", "2")
+	if err := json.Unmarshal([]byte(out), &merchant); err != nil || merchant.Name != "Pet Shop" {
+		t.Errorf("merchant add: merchant = %v, error = %v", merchant, err)
+		return
+	}
+	code, out, _ = run(dir, "merchant", "pay", "1", merchant.ID, "20000")
+	if code != ExitOK || !strings.Contains(out, "amount 20000 category cat") {
+		t.Errorf("merchant pay: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "merchant", "payments", merchant.ID)
+	if code != ExitOK || strings.Count(out, "payment ") != 1 {
+		t.Errorf("merchant payments: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "merchant", "settle", merchant.ID)
+	if code != ExitOK || !strings.Contains(out, "account 2 amount 20000") {
+		t.Errorf("merchant settle: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "merchant", "report", merchant.ID)
+	if code != ExitOK || !strings.Contains(out, "payments 1 gross 20000 refunded 0 net 20000 settled 20000 balance 0") {
+		t.Errorf("merchant report: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "merchant", "list")
+	if code != ExitOK || !strings.Contains(out, `name "Pet Shop" category cat settlement account 2 balance 0`) {
+		t.Errorf("merchant list: code = %v, out = %q", code, out)
+	}
+
+	code, out, _ = run(dir, "category", "add", "pets", "Pets", "-", "cat,kitten")
+	if code != ExitOK || !strings.Contains(out, `category pets name "Pets" parent  aliases [cat kitten]`) {
+		t.Errorf("category add: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "category", "migrate")
+	if code != ExitOK || !strings.Contains(out, "categories changed 5 unresolved []") {
+		t.Errorf("category migrate: code = %v, out = %q", code, out)
+	}
+	code, _, errOut = run(dir, "pay", "1", "1", "pest")
+	if code != ExitError || !strings.Contains(errOut, `did you mean "pets"`) {
+		t.Errorf("pay: unknown category must be rejected, code = %v, err = %q", code, errOut)
+	}
+	code, out, _ = run(dir, "category", "list")
+	if code != ExitOK || strings.Count(out, "category ") != 1 {
+		t.Errorf("category list: code = %v, out = %q", code, out)
+	}
+
+	exported := t.TempDir()
+	code, _, _ = run(dir, "export", exported)
+	if code != ExitOK {
+		t.Errorf("export: code = %v", code)
+	}
+	imported := t.TempDir()
+	code, _, _ = run(imported, "import", exported)
+	if code != ExitOK {
+		t.Errorf("import: code = %v", code)
+	}
+	code, out, _ = run(imported, "account", "1")
+	if code != ExitOK || !strings.Contains(out, "balance 930000") {
+		t.Errorf("account: code = %v, out = %q", code, out)
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	dir := t.TempDir()
+	run(dir, "register", "+992938638676")
+
+	code, _, errOut := run(dir, "pay", "1", "100", "cat")
+	if code != ExitError || !strings.Contains(errOut, "not enough balance") {
+		t.Errorf("pay: code = %v, err = %q", code, errOut)
+	}
+	code, _, errOut = run(dir, "-json", "account", "2")
+	if code != ExitError || !strings.Contains(errOut, `"kind":"not found"`) {
+		t.Errorf("account: code = %v, err = %q", code, errOut)
+	}
+	code, _, errOut = run(dir, "deposit", "1", "x")
+	if code != ExitUsage || !strings.Contains(errOut, "invalid amount") {
+		t.Errorf("deposit: code = %v, err = %q", code, errOut)
+	}
+	code, _, _ = run(dir, "unknown")
+	if code != ExitUsage {
+		t.Errorf("unknown: code = %v", code)
+	}
+	code, _, _ = run(dir)
+	if code != ExitUsage {
+		t.Errorf("no command: code = %v", code)
+	}
+}
+
+func TestRun_payCredential(t *testing.T) {
+	dir := t.TempDir()
+	svc := &wallet.Service{}
+	account, _ := svc.RegisterAccount("+992938638676")
+	svc.Deposit(account.ID, 1000)
+	svc.SetPIN(account.ID, "1234", types.Credential{})
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, errOut := run(dir, "pay", "1", "100", "food")
+	if code != ExitError || !strings.Contains(errOut, "credential required") {
+		t.Errorf("pay: code = %v, err = %q", code, errOut)
+	}
+	code, _, errOut = run(dir, "pay", "1", "100", "food", "0000")
+	if code != ExitError || !strings.Contains(errOut, "invalid credential") {
+		t.Errorf("pay: code = %v, err = %q", code, errOut)
+	}
+	code, out, _ := run(dir, "pay", "1", "100", "food", "1234")
+	if code != ExitOK || !strings.Contains(out, "amount 100") {
+		t.Errorf("pay: code = %v, out = %q", code, out)
+	}
+}
+
+func TestRun_config(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wallet.json")
+	content := `{"limits": {"max_payment": 1000}, "fees": [{"fixed": 10}]}`
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	run(dir, "register", "+992938638676")
+	run(dir, "-config", path, "deposit", "1", "5000")
+	code, out, _ := run(dir, "-config", path, "pay", "1", "1000", "cat")
+	if code != ExitOK || !strings.Contains(out, "amount 1000") {
+		t.Errorf("pay: code = %v, out = %q", code, out)
+	}
+	code, out, _ = run(dir, "account", "1")
+	if code != ExitOK || !strings.Contains(out, "balance 3990") {
+		t.Errorf("account: fee must be charged, code = %v, out = %q", code, out)
+	}
+	code, _, errOut := run(dir, "-config", path, "pay", "1", "1001", "cat")
+	if code != ExitError || !strings.Contains(errOut, "limit") {
+		t.Errorf("pay: code = %v, err = %q", code, errOut)
+	}
+
+	code, _, errOut = run(dir, "-config", filepath.Join(dir, "missing.json"), "account", "1")
+	if code != ExitConfig || !strings.Contains(errOut, "config") {
+		t.Errorf("account: code = %v, err = %q", code, errOut)
+	}
+}
@@ -0,0 +1,412 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/server"
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+func runRegister(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return e.svc.RegisterAccount(types.Phone(args[0]))
+}
+
+func runDeposit(e *env, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.svc.Deposit(accountID, amount); err != nil {
+		return nil, err
+	}
+	return e.svc.FindAccountByID(accountID)
+}
+
+func runPay(e *env, args []string) (interface{}, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		return e.svc.Pay(accountID, amount, types.PaymentCategory(args[2]))
+	}
+	auth := types.Credential{PIN: args[3]}
+	if len(args) == 5 {
+		auth.OTP = args[4]
+	}
+	return e.svc.PayWithCredential(accountID, amount, types.PaymentCategory(args[2]), auth)
+}
+
+func runReject(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	if err := e.svc.Reject(args[0]); err != nil {
+		return nil, err
+	}
+	return e.svc.FindPaymentByID(args[0])
+}
+
+func runRepeat(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return e.svc.Repeat(args[0])
+}
+
+func runFavoriteAdd(e *env, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	return e.svc.FavoritePayment(args[0], args[1])
+}
+
+func runFavoritePay(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errUsage
+	}
+	if len(args) == 1 {
+		return e.svc.PayFromFavorite(args[0])
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.PayFromFavoriteAmount(args[0], amount)
+}
+
+func runFavoriteList(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.FavoritesByAccount(accountID)
+}
+
+// runBudgetSet sets budget, "hard" and thresholds may follow the amount in any order
+func runBudgetSet(e *env, args []string) (interface{}, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[2])
+	if err != nil {
+		return nil, err
+	}
+	budget := types.Budget{AccountID: accountID, Category: types.PaymentCategory(args[1]), Amount: amount}
+	for _, arg := range args[3:] {
+		if arg == "hard" {
+			budget.Hard = true
+			continue
+		}
+		for _, field := range strings.Split(arg, ",") {
+			threshold, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid threshold %q", errUsage, field)
+			}
+			budget.Thresholds = append(budget.Thresholds, threshold)
+		}
+	}
+	return e.svc.SetBudget(budget)
+}
+
+func runBudgetRemove(e *env, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := e.svc.RemoveBudget(accountID, types.PaymentCategory(args[1])); err != nil {
+		return nil, err
+	}
+	return "budget removed", nil
+}
+
+func runBudgetStatus(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.BudgetStatus(accountID)
+}
+
+func runCategoryAdd(e *env, args []string) (interface{}, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, errUsage
+	}
+	category := types.Category{ID: types.PaymentCategory(args[0]), Name: args[1]}
+	if len(args) > 2 && args[2] != "-" {
+		category.Parent = types.PaymentCategory(args[2])
+	}
+	if len(args) > 3 {
+		category.Aliases = strings.Split(args[3], ",")
+	}
+	return e.svc.RegisterCategory(category)
+}
+
+func runCategoryList(e *env, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	return e.svc.Categories(), nil
+}
+
+func runCategoryMigrate(e *env, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	return e.svc.MigrateCategories()
+}
+
+func runMerchantAdd(e *env, args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.RegisterMerchant(args[0], types.PaymentCategory(args[1]), accountID)
+}
+
+func runMerchantList(e *env, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	return e.svc.Merchants(), nil
+}
+
+func runMerchantPay(e *env, args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.PayMerchant(accountID, args[1], amount)
+}
+
+func runMerchantPayments(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return e.svc.MerchantPayments(args[0])
+}
+
+func runMerchantSettle(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return e.svc.SettleMerchant(args[0])
+}
+
+func runMerchantReport(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return e.svc.SettlementReport(args[0], time.Time{}, time.Time{})
+}
+
+func runRefund(e *env, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.Refund(args[0], amount)
+}
+
+func runAccount(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return e.svc.FindAccountByID(accountID)
+}
+
+// runFind finds account by id, other values are looked up as phones
+func runFind(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	if accountID, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+		return e.svc.FindAccountByID(accountID)
+	}
+	return e.svc.FindAccountByPhone(types.Phone(args[0]))
+}
+
+// runHistory lists payments in order they were made or by order of the argument
+func runHistory(e *env, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	order := wallet.OrderInserted
+	if len(args) == 2 {
+		order = wallet.PaymentOrder(args[1])
+	}
+	return e.svc.FilterPaymentsSorted(accountID, order, e.config.Workers.Filter)
+}
+
+// runSum sums payments with goroutines of the argument or the config
+func runSum(e *env, args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, errUsage
+	}
+	goroutines := e.config.Workers.Sum
+	if len(args) == 1 {
+		value, err := strconv.Atoi(args[0])
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("%w: invalid goroutines %q", errUsage, args[0])
+		}
+		goroutines = value
+	}
+	return e.svc.SumPayments(goroutines), nil
+}
+
+// runReport makes spending report of account by period of the argument
+func runReport(e *env, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	options := wallet.ReportOptions{Location: time.Local, Goroutines: e.config.Workers.Sum}
+	if len(args) > 1 {
+		options.Period = types.ReportPeriod(args[1])
+	}
+	report, err := e.svc.SpendingReport(accountID, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		if err := wallet.ExportReport(report, args[2]); err != nil {
+			return nil, err
+		}
+		return "report written to " + args[2], nil
+	}
+	return report, nil
+}
+
+func runExport(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	if err := os.MkdirAll(args[0], 0777); err != nil {
+		return nil, err
+	}
+	if err := e.svc.Export(args[0]); err != nil {
+		return nil, err
+	}
+	return "exported to " + args[0], nil
+}
+
+// runImport replaces data with dumps of dir, saving the data replaces
+// every dump of data directory
+func runImport(e *env, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	svc := &wallet.Service{}
+	if err := e.config.Apply(svc); err != nil {
+		return nil, err
+	}
+	if err := svc.Import(args[0]); err != nil {
+		return nil, err
+	}
+	e.svc = svc
+	return "imported from " + args[0], nil
+}
+
+// runServe serves REST API until interrupt, POST /export writes data back
+func runServe(e *env, args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	addr := flags.String("addr", e.config.ListenAddr, "address to listen on")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return nil, errUsage
+	}
+
+	level, err := wallet.ParseLevel(e.config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logger := wallet.NewTextLogger(e.stderr, level)
+	e.svc.SetLogger(logger)
+	handler := server.NewServer(e.svc, e.dataDir)
+	handler.SetConfigure(func(svc *wallet.Service) error {
+		svc.SetLogger(logger)
+		return e.config.Apply(svc)
+	})
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			fmt.Fprintln(e.stderr, err)
+		}
+	}()
+
+	fmt.Fprintf(e.stderr, "listening on %s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Control keys of terminal in raw mode
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = 9
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// lineReader reads lines of the shell
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from input which is not a terminal
+type plainReader struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func (p *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	if !p.in.Scan() {
+		if err := p.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return p.in.Text(), nil
+}
+
+// completer returns candidates for the word starting with prefix, words are
+// the words of the line before it
+type completer func(words []string, prefix string) []string
+
+// lineEditor edits lines of terminal in raw mode: tab completes the current
+// word, up and down arrows walk through history
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete completer
+	history  []string
+}
+
+func (l *lineEditor) readLine(prompt string) (string, error) {
+	line := []rune{}
+	position := len(l.history)
+	l.redraw(prompt, line)
+
+	for {
+		r, _, err := l.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(l.out, "\r\n")
+			text := string(line)
+			l.remember(text)
+			return text, nil
+		case keyCtrlC:
+			fmt.Fprint(l.out, "^C\r\n")
+			line = line[:0]
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(l.out, "\r\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case keyTab:
+			line = l.completeLine(line)
+		case keyEscape:
+			// arrows are sent as ESC [ A and ESC [ B
+			if next, _, err := l.in.ReadRune(); err != nil || next != '[' {
+				continue
+			}
+			arrow, _, err := l.in.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case arrow == 'A' && position > 0:
+				position--
+				line = []rune(l.history[position])
+			case arrow == 'B' && position < len(l.history)-1:
+				position++
+				line = []rune(l.history[position])
+			case arrow == 'B':
+				position = len(l.history)
+				line = line[:0]
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line, r)
+			}
+		}
+		l.redraw(prompt, line)
+	}
+}
+
+func (l *lineEditor) redraw(prompt string, line []rune) {
+	fmt.Fprint(l.out, "\r\x1b[K"+prompt+string(line))
+}
+
+// remember adds line to history unless it is empty or repeats the last one
+func (l *lineEditor) remember(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(l.history) != 0 && l.history[len(l.history)-1] == line {
+		return
+	}
+	l.history = append(l.history, line)
+}
+
+// completeLine completes the last word of line, when there are several
+// candidates it is extended to their common prefix or they are listed
+func (l *lineEditor) completeLine(line []rune) []rune {
+	if l.complete == nil {
+		return line
+	}
+	text := string(line)
+	head, prefix := "", text
+	if i := strings.LastIndex(text, " "); i >= 0 {
+		head, prefix = text[:i+1], text[i+1:]
+	}
+
+	candidates := l.complete(strings.Fields(head), prefix)
+	switch len(candidates) {
+	case 0:
+		return line
+	case 1:
+		return []rune(head + candidates[0] + " ")
+	}
+
+	common := commonPrefix(candidates)
+	if len(common) > len(prefix) {
+		return []rune(head + common)
+	}
+	sort.Strings(candidates)
+	fmt.Fprint(l.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	return line
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const shellPrompt = "wallet> "
+
+// shellCommands are available only in the shell, exit and help are handled by the shell loop
+var shellCommands = []command{
+	{"save", "", "write changes to data directory", false, runSave},
+	{"help", "", "list commands", false, nil},
+	{"exit", "", "leave the shell", false, nil},
+}
+
+// shellExcluded are commands which make no sense inside the shell
+var shellExcluded = map[string]bool{"shell": true, "serve": true, "import": true}
+
+// commands returns commands available in the current mode
+func (e *env) commands() []command {
+	if !e.shell {
+		return commands
+	}
+	list := []command{}
+	for _, cmd := range commands {
+		if !shellExcluded[cmd.name] {
+			list = append(list, cmd)
+		}
+	}
+	return append(list, shellCommands...)
+}
+
+// runShell reads commands until exit, changes are kept in memory until save
+func runShell(e *env, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	e.shell = true
+	defer func() { e.shell = false }()
+
+	reader, restore := e.lineReader()
+	if restore != nil {
+		defer restore()
+	}
+
+	warned := false
+	for {
+		line, err := reader.readLine(shellPrompt)
+		if err == io.EOF {
+			if e.unsaved {
+				fmt.Fprintln(e.stderr, "unsaved changes are discarded")
+			}
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			if e.unsaved && !warned {
+				fmt.Fprintln(e.stderr, "there are unsaved changes, run save or exit again to discard them")
+				warned = true
+				continue
+			}
+			return nil, nil
+		case "help":
+			printCommands(e.stdout, e.commands())
+			continue
+		}
+		e.exec(args)
+	}
+}
+
+func runSave(e *env, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	if err := e.save(); err != nil {
+		return nil, err
+	}
+	e.unsaved = false
+	return "saved to " + e.dataDir, nil
+}
+
+// lineReader returns line editor when stdin is a terminal, restore switches
+// the terminal back to its mode
+func (e *env) lineReader() (reader lineReader, restore func()) {
+	if file, ok := e.stdin.(*os.File); ok {
+		restore, err := makeRaw(int(file.Fd()))
+		if err == nil {
+			return &lineEditor{in: bufio.NewReader(file), out: e.stdout, complete: e.complete}, restore
+		}
+	}
+	return &plainReader{in: bufio.NewScanner(e.stdin), out: e.stdout}, nil
+}
+
+// complete completes command names, then account, payment and favorite IDs and phones
+func (e *env) complete(words []string, prefix string) []string {
+	names := []string{}
+	for _, cmd := range e.commands() {
+		names = append(names, cmd.name)
+	}
+
+	candidates := []string{}
+	switch {
+	case len(words) == 0:
+		candidates = firstWords(names)
+	case len(words) == 1 && isGroup(names, words[0]):
+		for _, name := range names {
+			if strings.HasPrefix(name, words[0]+" ") {
+				candidates = append(candidates, strings.TrimPrefix(name, words[0]+" "))
+			}
+		}
+	default:
+		candidates = e.ids()
+	}
+
+	matched := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matched = append(matched, candidate)
+		}
+	}
+	return matched
+}
+
+// ids returns IDs and phones known to the service
+func (e *env) ids() []string {
+	ids := []string{}
+	for _, account := range e.svc.Accounts() {
+		ids = append(ids, strconv.FormatInt(account.ID, 10), string(account.Phone))
+		payments, _ := e.svc.ExportAccountHistory(account.ID)
+		for _, payment := range payments {
+			ids = append(ids, payment.ID)
+		}
+		favorites, _ := e.svc.FavoritesByAccount(account.ID)
+		for _, favorite := range favorites {
+			ids = append(ids, favorite.ID)
+		}
+	}
+	return ids
+}
+
+func firstWords(names []string) []string {
+	words := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		word := strings.Fields(name)[0]
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// isGroup reports whether word starts commands of two words like "favorite add"
+func isGroup(names []string, word string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, word+" ") {
+			return true
+		}
+	}
+	return false
+}
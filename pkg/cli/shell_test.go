@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/config"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+func newTestEnv(t *testing.T, input string) (*env, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	e := &env{
+		config:  config.Default(),
+		dataDir: t.TempDir(),
+		svc:     &wallet.Service{},
+		stdin:   strings.NewReader(input),
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+	return e, stdout, stderr
+}
+
+func TestShell_save(t *testing.T) {
+	e, stdout, stderr := newTestEnv(t, "register +992938638676\ndeposit 1 1000\nfind +992938638676\nexit\nsave\nexit\n")
+
+	code := e.exec([]string{"shell"})
+	if code != ExitOK {
+		t.Errorf("shell: code = %v, err = %q", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "account 1 phone +992938638676 balance 1000") {
+		t.Errorf("shell: wrong output = %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "unsaved changes") {
+		t.Errorf("shell: must warn about unsaved changes, err = %q", stderr.String())
+	}
+
+	code, out, _ := run(e.dataDir, "account", "1")
+	if code != ExitOK || !strings.Contains(out, "balance 1000") {
+		t.Errorf("account: code = %v, out = %q", code, out)
+	}
+}
+
+func TestShell_unsaved(t *testing.T) {
+	e, _, stderr := newTestEnv(t, "register +992938638676\nunknown\n")
+
+	code := e.exec([]string{"shell"})
+	if code != ExitOK {
+		t.Errorf("shell: code = %v", code)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "unknown"`) || !strings.Contains(stderr.String(), "discarded") {
+		t.Errorf("shell: wrong err = %q", stderr.String())
+	}
+	code, _, _ = run(e.dataDir, "account", "1")
+	if code != ExitError {
+		t.Errorf("account: must not be saved, code = %v", code)
+	}
+}
+
+func TestShell_complete(t *testing.T) {
+	e, _, _ := newTestEnv(t, "")
+	e.shell = true
+	account, _ := e.svc.RegisterAccount("+992938638676")
+	e.svc.Deposit(account.ID, 1000)
+	payment, _ := e.svc.Pay(account.ID, 100, "cat")
+
+	tests := []struct {
+		words  []string
+		prefix string
+		want   []string
+	}{
+		{nil, "fa", []string{"favorite"}},
+		{nil, "s", []string{"sum", "save"}},
+		{[]string{"favorite"}, "", []string{"add", "pay", "list"}},
+		{[]string{"reject"}, payment.ID[:8], []string{payment.ID}},
+		{[]string{"find"}, "+99", []string{"+992938638676"}},
+	}
+	for _, test := range tests {
+		got := e.complete(test.words, test.prefix)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("complete(%v, %q) = %v, want %v", test.words, test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestLineEditor_readLine(t *testing.T) {
+	complete := func(words []string, prefix string) []string {
+		candidates := []string{"12345", "12399"}
+		if len(words) == 0 {
+			candidates = []string{"history"}
+		}
+		matched := []string{}
+		for _, candidate := range candidates {
+			if strings.HasPrefix(candidate, prefix) {
+				matched = append(matched, candidate)
+			}
+		}
+		return matched
+	}
+	input := "hi\t1\t4\t\r" + "x\x7f\x1b[A\r" + "\x03\x04"
+	l := &lineEditor{in: bufio.NewReader(strings.NewReader(input)), out: ioutil.Discard, complete: complete}
+
+	line, err := l.readLine("> ")
+	if err != nil || line != "history 12345 " {
+		t.Errorf("readLine(): line = %q, error = %v", line, err)
+	}
+	line, err = l.readLine("> ")
+	if err != nil || line != "history 12345 " {
+		t.Errorf("readLine(): history line = %q, error = %v", line, err)
+	}
+	_, err = l.readLine("> ")
+	if err != io.EOF {
+		t.Errorf("readLine(): must return io.EOF, returned = %v", err)
+	}
+	if len(l.history) != 1 {
+		t.Errorf("readLine(): wrong history = %v", l.history)
+	}
+}
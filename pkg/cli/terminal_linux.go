@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package cli
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw switches terminal to raw mode and returns function restoring it,
+// it fails when fd is not a terminal
+func makeRaw(fd int) (func(), error) {
+	old := syscall.Termios{}
+	if err := ioctl(fd, syscall.TCGETS, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON | syscall.BRKINT | syscall.INPCK | syscall.ISTRIP
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, syscall.TCSETS, &old) }, nil
+}
+
+func ioctl(fd int, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package cli
+
+import "errors"
+
+// makeRaw is supported on linux only, other systems read plain lines
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
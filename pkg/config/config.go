@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+// DumpFormatText is the ";" separated format of Export and Import,
+// the only dump format supported now
+const DumpFormatText = "text"
+
+// Config of the wallet binary, it is read from JSON file and environment
+// variables override the file
+type Config struct {
+	DataDir    string          `json:"data_dir"`
+	DumpFormat string          `json:"dump_format"`
+	ListenAddr string          `json:"listen_addr"`
+	LogLevel   string          `json:"log_level"`
+	Limits     Limits          `json:"limits"`
+	Fees       []types.FeeRule `json:"fees"`
+	Workers    Workers         `json:"workers"`
+}
+
+// Limits of operations, zero means no limit
+type Limits struct {
+	MaxPayment    types.Money `json:"max_payment"`
+	MaxDeposit    types.Money `json:"max_deposit"`
+	AuthThreshold types.Money `json:"auth_threshold"`
+	HoldTTL       Duration    `json:"hold_ttl"`
+}
+
+// Workers are goroutine counts of the parallel functions
+type Workers struct {
+	Sum    int `json:"sum"`
+	Filter int `json:"filter"`
+}
+
+// Duration is written in config as "15m" or "1h30m"
+type Duration time.Duration
+
+// UnmarshalJSON parses duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns configuration used when there is no config file
+func Default() Config {
+	return Config{
+		DataDir:    "data",
+		DumpFormat: DumpFormatText,
+		ListenAddr: ":8080",
+		LogLevel:   wallet.LevelInfo.String(),
+		Workers:    Workers{Sum: 1, Filter: 1},
+	}
+}
+
+// Load reads config file over defaults, empty path means no file, then applies
+// variables of getenv like WALLET_DATA_DIR and validates the result
+func Load(path string, getenv func(string) string) (Config, error) {
+	config := Default()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("config: %v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return config, fmt.Errorf("config %s: %v", path, err)
+		}
+	}
+
+	if err := config.applyEnv(getenv); err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// applyEnv overrides fields by environment variables
+func (c *Config) applyEnv(getenv func(string) string) error {
+	texts := []struct {
+		name  string
+		field *string
+	}{
+		{"WALLET_DATA_DIR", &c.DataDir},
+		{"WALLET_DUMP_FORMAT", &c.DumpFormat},
+		{"WALLET_LISTEN_ADDR", &c.ListenAddr},
+		{"WALLET_LOG_LEVEL", &c.LogLevel},
+	}
+	for _, variable := range texts {
+		if value := getenv(variable.name); value != "" {
+			*variable.field = value
+		}
+	}
+
+	money := []struct {
+		name  string
+		field *types.Money
+	}{
+		{"WALLET_MAX_PAYMENT", &c.Limits.MaxPayment},
+		{"WALLET_MAX_DEPOSIT", &c.Limits.MaxDeposit},
+		{"WALLET_AUTH_THRESHOLD", &c.Limits.AuthThreshold},
+	}
+	for _, variable := range money {
+		if value := getenv(variable.name); value != "" {
+			amount, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("config: %s: %q is not an amount", variable.name, value)
+			}
+			*variable.field = types.Money(amount)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		field *int
+	}{
+		{"WALLET_SUM_WORKERS", &c.Workers.Sum},
+		{"WALLET_FILTER_WORKERS", &c.Workers.Filter},
+	}
+	for _, variable := range counts {
+		if value := getenv(variable.name); value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("config: %s: %q is not a number", variable.name, value)
+			}
+			*variable.field = count
+		}
+	}
+
+	if value := getenv("WALLET_HOLD_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("config: WALLET_HOLD_TTL: %v", err)
+		}
+		c.Limits.HoldTTL = Duration(ttl)
+	}
+	if value := getenv("WALLET_FEES"); value != "" {
+		c.Fees = nil
+		if err := json.Unmarshal([]byte(value), &c.Fees); err != nil {
+			return fmt.Errorf("config: WALLET_FEES: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks every field and reports the first wrong one
+func (c Config) Validate() error {
+	switch {
+	case strings.TrimSpace(c.DataDir) == "":
+		return fmt.Errorf("config: data_dir must not be empty")
+	case c.DumpFormat != DumpFormatText:
+		return fmt.Errorf("config: dump_format %q is not supported, use %q", c.DumpFormat, DumpFormatText)
+	case strings.TrimSpace(c.ListenAddr) == "":
+		return fmt.Errorf("config: listen_addr must not be empty")
+	case c.Limits.MaxPayment < 0 || c.Limits.MaxDeposit < 0 || c.Limits.AuthThreshold < 0:
+		return fmt.Errorf("config: limits must not be negative")
+	case c.Limits.HoldTTL < 0:
+		return fmt.Errorf("config: limits.hold_ttl must not be negative")
+	case c.Workers.Sum < 1 || c.Workers.Filter < 1:
+		return fmt.Errorf("config: workers must be at least 1")
+	}
+	if _, err := wallet.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("config: log_level: %v", err)
+	}
+	if err := wallet.ValidateFeeRules(c.Fees); err != nil {
+		return fmt.Errorf("config: fees: %v", err)
+	}
+	return nil
+}
+
+// Apply configures service by limits and fees
+func (c Config) Apply(svc *wallet.Service) error {
+	svc.SetLimits(c.Limits.MaxPayment, c.Limits.MaxDeposit)
+	svc.SetAuthThreshold(c.Limits.AuthThreshold)
+	if c.Limits.HoldTTL != 0 {
+		svc.SetHoldTTL(time.Duration(c.Limits.HoldTTL))
+	}
+	return svc.SetFeeRules(c.Fees)
+}
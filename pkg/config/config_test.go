@@ -0,0 +1,99 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestLoad_fileAndEnv(t *testing.T) {
+	path := writeConfig(t, `{
+		"data_dir": "/var/lib/wallet",
+		"listen_addr": ":9000",
+		"log_level": "warn",
+		"limits": {"max_payment": 100000, "hold_ttl": "30m"},
+		"fees": [{"category": "", "basis_points": 100, "min": 10}],
+		"workers": {"sum": 4, "filter": 2}
+	}`)
+
+	config, err := Load(path, env(map[string]string{"WALLET_LISTEN_ADDR": ":9100", "WALLET_SUM_WORKERS": "8"}))
+	if err != nil {
+		t.Errorf("Load(): error = %v", err)
+		return
+	}
+	if config.DataDir != "/var/lib/wallet" || config.ListenAddr != ":9100" || config.LogLevel != "warn" {
+		t.Errorf("Load(): wrong config = %+v", config)
+	}
+	if config.Limits.MaxPayment != 100000 || time.Duration(config.Limits.HoldTTL) != 30*time.Minute {
+		t.Errorf("Load(): wrong limits = %+v", config.Limits)
+	}
+	if config.Workers.Sum != 8 || config.Workers.Filter != 2 || len(config.Fees) != 1 {
+		t.Errorf("Load(): wrong workers = %+v, fees = %+v", config.Workers, config.Fees)
+	}
+	if config.DumpFormat != DumpFormatText {
+		t.Errorf("Load(): default dump format is not kept = %v", config.DumpFormat)
+	}
+
+	svc := &wallet.Service{}
+	if err := config.Apply(svc); err != nil {
+		t.Errorf("Apply(): error = %v", err)
+	}
+}
+
+func TestLoad_default(t *testing.T) {
+	config, err := Load("", env(nil))
+	if err != nil {
+		t.Errorf("Load(): error = %v", err)
+		return
+	}
+	if config.DataDir != "data" || config.ListenAddr != ":8080" {
+		t.Errorf("Load(): wrong config = %+v", config)
+	}
+}
+
+func TestLoad_invalid(t *testing.T) {
+	tests := []struct {
+		content string
+		env     map[string]string
+		message string
+	}{
+		{`{"data_dir": ""}`, nil, "data_dir must not be empty"},
+		{`{"dump_format": "xml"}`, nil, `dump_format "xml" is not supported`},
+		{`{"log_level": "loud"}`, nil, "log_level"},
+		{`{"workers": {"sum": 0}}`, nil, "workers must be at least 1"},
+		{`{"limits": {"max_deposit": -1}}`, nil, "limits must not be negative"},
+		{`{"limits": {"hold_ttl": 5}}`, nil, "duration must be a string"},
+		{`{"fees": [{"category": "cat"}, {"category": "cat"}]}`, nil, "repeated rule"},
+		{`{"data": "x"}`, nil, `unknown field "data"`},
+		{`{}`, map[string]string{"WALLET_MAX_PAYMENT": "ten"}, `WALLET_MAX_PAYMENT: "ten" is not an amount`},
+	}
+	for _, test := range tests {
+		_, err := Load(writeConfig(t, test.content), env(test.env))
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Load(%s): must return %q, returned = %v", test.content, test.message, err)
+		}
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.json"), env(nil))
+	if err == nil {
+		t.Error("Load(): must return error for missing file")
+	}
+}
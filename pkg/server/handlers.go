@@ -0,0 +1,462 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+type registerRequest struct {
+	Phone types.Phone `json:"phone"`
+}
+
+type depositRequest struct {
+	Amount types.Money `json:"amount"`
+}
+
+type payRequest struct {
+	AccountID int64                 `json:"account_id"`
+	Amount    types.Money           `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+	PIN       string                `json:"pin,omitempty"`
+	OTP       string                `json:"otp,omitempty"`
+}
+
+type favoriteRequest struct {
+	PaymentID string `json:"payment_id"`
+	Name      string `json:"name"`
+}
+
+type favoritePayRequest struct {
+	Amount types.Money `json:"amount,omitempty"`
+}
+
+type budgetRequest struct {
+	Amount     types.Money `json:"amount"`
+	Thresholds []int       `json:"thresholds,omitempty"`
+	Hard       bool        `json:"hard"`
+}
+
+type categoryRequest struct {
+	Name    string                `json:"name"`
+	Parent  types.PaymentCategory `json:"parent,omitempty"`
+	Aliases []string              `json:"aliases,omitempty"`
+}
+
+type merchantRequest struct {
+	Name                string                `json:"name"`
+	Category            types.PaymentCategory `json:"category"`
+	SettlementAccountID int64                 `json:"settlement_account_id"`
+}
+
+type merchantPayRequest struct {
+	AccountID int64       `json:"account_id"`
+	Amount    types.Money `json:"amount"`
+}
+
+type dumpResponse struct {
+	Dir string `json:"dir"`
+}
+
+func (s *Server) registerAccount(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := registerRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+
+	account, err := s.svc.RegisterAccount(request.Phone)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, account, nil
+}
+
+func (s *Server) getAccount(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	account, err := s.svc.FindAccountByID(accountID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, account, nil
+}
+
+func (s *Server) freezeAccount(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := s.svc.FreezeAccount(accountID); err != nil {
+		return 0, nil, err
+	}
+	return s.getAccount(ctx, r, params)
+}
+
+func (s *Server) unfreezeAccount(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := s.svc.UnfreezeAccount(accountID); err != nil {
+		return 0, nil, err
+	}
+	return s.getAccount(ctx, r, params)
+}
+
+func (s *Server) deposit(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	request := depositRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+
+	if err := s.svc.Deposit(accountID, request.Amount); err != nil {
+		return 0, nil, err
+	}
+	return s.getAccount(ctx, r, params)
+}
+
+// accountPayments lists payments of account sorted by ?order= or in order they
+// were made, account without payments has empty list
+func (s *Server) accountPayments(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	order := wallet.PaymentOrder(r.URL.Query().Get("order"))
+	payments, err := s.svc.FilterPaymentsSortedContext(ctx, accountID, order, 1)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, payments, nil
+}
+
+// accountReport returns spending report of account by ?period=, ?from= and ?to=
+// in RFC 3339, periods are split in UTC
+func (s *Server) accountReport(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	options := wallet.ReportOptions{Period: types.ReportPeriod(r.URL.Query().Get("period"))}
+	if err := parseBounds(r, &options.From, &options.To); err != nil {
+		return 0, nil, err
+	}
+	report, err := s.svc.SpendingReportContext(ctx, accountID, options)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, report, nil
+}
+
+// accountBudgets returns spending of budgets of account in this month
+func (s *Server) accountBudgets(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	statuses, err := s.svc.BudgetStatus(accountID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, statuses, nil
+}
+
+// setBudget sets budget of account in category of the path
+func (s *Server) setBudget(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	request := budgetRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+	budget, err := s.svc.SetBudget(types.Budget{
+		AccountID:  accountID,
+		Category:   types.PaymentCategory(params[1]),
+		Amount:     request.Amount,
+		Thresholds: request.Thresholds,
+		Hard:       request.Hard,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, budget, nil
+}
+
+// removeBudget removes budget and returns the rest of budgets of account
+func (s *Server) removeBudget(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.svc.RemoveBudget(accountID, types.PaymentCategory(params[1])); err != nil {
+		return 0, nil, err
+	}
+	return s.accountBudgets(ctx, r, params)
+}
+
+// categories returns the category registry
+func (s *Server) categories(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	return http.StatusOK, s.svc.Categories(), nil
+}
+
+// registerCategory registers or replaces category with ID of the path
+func (s *Server) registerCategory(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := categoryRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+	category, err := s.svc.RegisterCategory(types.Category{
+		ID:      types.PaymentCategory(params[0]),
+		Name:    request.Name,
+		Parent:  request.Parent,
+		Aliases: request.Aliases,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, category, nil
+}
+
+// migrateCategories rewrites free text categories to IDs of the registry
+func (s *Server) migrateCategories(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	migration, err := s.svc.MigrateCategories()
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, migration, nil
+}
+
+// merchants returns registered merchants
+func (s *Server) merchants(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	return http.StatusOK, s.svc.Merchants(), nil
+}
+
+func (s *Server) registerMerchant(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := merchantRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+	merchant, err := s.svc.RegisterMerchant(request.Name, request.Category, request.SettlementAccountID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, merchant, nil
+}
+
+func (s *Server) getMerchant(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	merchant, err := s.svc.FindMerchantByID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, merchant, nil
+}
+
+func (s *Server) merchantPayments(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	payments, err := s.svc.MerchantPayments(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, payments, nil
+}
+
+// payMerchant pays merchant of the path from account of the body
+func (s *Server) payMerchant(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := merchantPayRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+	payment, err := s.svc.PayMerchant(request.AccountID, params[0], request.Amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, payment, nil
+}
+
+func (s *Server) settleMerchant(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	settlement, err := s.svc.SettleMerchant(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, settlement, nil
+}
+
+// merchantReport returns settlement report of merchant, from and to are RFC3339 times
+func (s *Server) merchantReport(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	var from, to time.Time
+	if err := parseBounds(r, &from, &to); err != nil {
+		return 0, nil, err
+	}
+	report, err := s.svc.SettlementReport(params[0], from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, report, nil
+}
+
+func (s *Server) accountFavorites(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	accountID, err := parseID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	favorites, err := s.svc.FavoritesByAccount(accountID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, favorites, nil
+}
+
+// pay makes payment, request with pin is confirmed by credential
+func (s *Server) pay(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := payRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+
+	var payment *types.Payment
+	var err error
+	if request.PIN != "" {
+		auth := types.Credential{PIN: request.PIN, OTP: request.OTP}
+		payment, err = s.svc.PayWithCredential(request.AccountID, request.Amount, request.Category, auth)
+	} else {
+		payment, err = s.svc.Pay(request.AccountID, request.Amount, request.Category)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, payment, nil
+}
+
+func (s *Server) getPayment(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	payment, err := s.svc.FindPaymentByID(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, payment, nil
+}
+
+// queryPayments returns a page of payments selected by wallet.PaymentQuery of the body
+func (s *Server) queryPayments(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	query := wallet.PaymentQuery{}
+	if err := decode(r, &query); err != nil {
+		return 0, nil, err
+	}
+	page, err := s.svc.QueryPaymentsContext(ctx, query)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, page, nil
+}
+
+func (s *Server) reject(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	if err := s.svc.Reject(params[0]); err != nil {
+		return 0, nil, err
+	}
+	return s.getPayment(ctx, r, params)
+}
+
+func (s *Server) repeat(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	payment, err := s.svc.Repeat(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, payment, nil
+}
+
+func (s *Server) createFavorite(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := favoriteRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+
+	favorite, err := s.svc.FavoritePayment(request.PaymentID, request.Name)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, favorite, nil
+}
+
+// payFromFavorite pays the favorite amount unless request has other amount
+func (s *Server) payFromFavorite(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	request := favoritePayRequest{}
+	if err := decode(r, &request); err != nil {
+		return 0, nil, err
+	}
+
+	var payment *types.Payment
+	var err error
+	if request.Amount != 0 {
+		payment, err = s.svc.PayFromFavoriteAmount(params[0], request.Amount)
+	} else {
+		payment, err = s.svc.PayFromFavorite(params[0])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, payment, nil
+}
+
+func (s *Server) export(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	if err := s.svc.ExportContext(ctx, s.dataDir); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, dumpResponse{Dir: s.dataDir}, nil
+}
+
+// importDumps replaces the service by one imported from dataDir, importing
+// into the current service would add everything again
+func (s *Server) importDumps(ctx context.Context, r *http.Request, params []string) (int, interface{}, error) {
+	svc := &wallet.Service{}
+	if s.configure != nil {
+		if err := s.configure(svc); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := svc.ImportContext(ctx, s.dataDir); err != nil {
+		return 0, nil, err
+	}
+	s.svc = svc
+	return http.StatusOK, dumpResponse{Dir: s.dataDir}, nil
+}
+
+// parseBounds parses RFC3339 times of from and to query parameters, missing ones stay zero
+func parseBounds(r *http.Request, from *time.Time, to *time.Time) error {
+	query := r.URL.Query()
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", from}, {"to", to}} {
+		if text := query.Get(bound.name); text != "" {
+			value, err := time.Parse(time.RFC3339, text)
+			if err != nil {
+				return badRequest("invalid " + bound.name + " " + strconv.Quote(text))
+			}
+			*bound.value = value
+		}
+	}
+	return nil
+}
+
+func parseID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, badRequest("invalid id " + strconv.Quote(value))
+	}
+	return id, nil
+}
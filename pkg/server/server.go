@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+// maxBodySize limits JSON request bodies
+const maxBodySize = 1 << 20
+
+var errBadRequest = errors.New("bad request")
+
+// Server serves the wallet REST API, Service is not safe for concurrent use
+// so requests are handled one at a time
+type Server struct {
+	mu        sync.Mutex
+	svc       *wallet.Service
+	dataDir   string
+	configure func(svc *wallet.Service) error
+	routes    []route
+}
+
+// handler handles request with path parameters matched by "*" of the route
+// and returns status with the body which is encoded to JSON
+type handler func(ctx context.Context, r *http.Request, params []string) (int, interface{}, error)
+
+type route struct {
+	method  string
+	pattern []string
+	handle  handler
+}
+
+// errorResponse body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+	Kind  string `json:"kind"`
+}
+
+// NewServer creates server of svc, export and import use dump files in dataDir
+func NewServer(svc *wallet.Service, dataDir string) *Server {
+	s := &Server{svc: svc, dataDir: dataDir}
+	s.routes = []route{
+		{http.MethodPost, []string{"accounts"}, s.registerAccount},
+		{http.MethodGet, []string{"accounts", "*"}, s.getAccount},
+		{http.MethodPost, []string{"accounts", "*", "freeze"}, s.freezeAccount},
+		{http.MethodPost, []string{"accounts", "*", "unfreeze"}, s.unfreezeAccount},
+		{http.MethodPost, []string{"accounts", "*", "deposits"}, s.deposit},
+		{http.MethodGet, []string{"accounts", "*", "payments"}, s.accountPayments},
+		{http.MethodGet, []string{"accounts", "*", "favorites"}, s.accountFavorites},
+		{http.MethodGet, []string{"accounts", "*", "report"}, s.accountReport},
+		{http.MethodGet, []string{"accounts", "*", "budgets"}, s.accountBudgets},
+		{http.MethodPut, []string{"accounts", "*", "budgets", "*"}, s.setBudget},
+		{http.MethodDelete, []string{"accounts", "*", "budgets", "*"}, s.removeBudget},
+		{http.MethodGet, []string{"categories"}, s.categories},
+		{http.MethodPut, []string{"categories", "*"}, s.registerCategory},
+		{http.MethodPost, []string{"categories", "migrate"}, s.migrateCategories},
+		{http.MethodGet, []string{"merchants"}, s.merchants},
+		{http.MethodPost, []string{"merchants"}, s.registerMerchant},
+		{http.MethodGet, []string{"merchants", "*"}, s.getMerchant},
+		{http.MethodGet, []string{"merchants", "*", "payments"}, s.merchantPayments},
+		{http.MethodPost, []string{"merchants", "*", "payments"}, s.payMerchant},
+		{http.MethodPost, []string{"merchants", "*", "settlements"}, s.settleMerchant},
+		{http.MethodGet, []string{"merchants", "*", "report"}, s.merchantReport},
+		{http.MethodPost, []string{"payments"}, s.pay},
+		{http.MethodPost, []string{"payments", "query"}, s.queryPayments},
+		{http.MethodGet, []string{"payments", "*"}, s.getPayment},
+		{http.MethodPost, []string{"payments", "*", "reject"}, s.reject},
+		{http.MethodPost, []string{"payments", "*", "repeat"}, s.repeat},
+		{http.MethodPost, []string{"favorites"}, s.createFavorite},
+		{http.MethodPost, []string{"favorites", "*", "pay"}, s.payFromFavorite},
+		{http.MethodPost, []string{"export"}, s.export},
+		{http.MethodPost, []string{"import"}, s.importDumps},
+	}
+	return s
+}
+
+// SetConfigure sets function which configures services made by import
+// the same way as the service given to NewServer, nil keeps them zero
+func (s *Server) SetConfigure(configure func(svc *wallet.Service) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configure = configure
+}
+
+// ServeHTTP routes request to its handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	pathFound := false
+	for _, rt := range s.routes {
+		params, ok := match(rt.pattern, segments)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if rt.method != r.Method {
+			continue
+		}
+		s.serve(w, r, rt.handle, params)
+		return
+	}
+
+	if pathFound {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed", Kind: "validation"})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: "route not found", Kind: "not found"})
+}
+
+// serve calls handler with the service locked, the body is encoded before
+// unlocking because it may point to service data
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, handle handler, params []string) {
+	s.mu.Lock()
+	status, body, err := handle(r.Context(), r, params)
+	if err != nil {
+		status, body = errorStatus(err), errorResponse{Error: err.Error(), Kind: kindOf(err)}
+	}
+	data, err := json.Marshal(body)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error(), Kind: wallet.KindUnknown.String()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func match(pattern []string, segments []string) ([]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var params []string
+	for i, part := range pattern {
+		switch {
+		case part == "*":
+			params = append(params, segments[i])
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// errorStatus maps kind of service error to HTTP status
+func errorStatus(err error) int {
+	if errors.Is(err, errBadRequest) {
+		return http.StatusBadRequest
+	}
+	switch wallet.KindOf(err) {
+	case wallet.KindNotFound:
+		return http.StatusNotFound
+	case wallet.KindValidation:
+		return http.StatusBadRequest
+	case wallet.KindConflict:
+		return http.StatusConflict
+	case wallet.KindInsufficientFunds:
+		return http.StatusUnprocessableEntity
+	case wallet.KindForbidden:
+		return http.StatusForbidden
+	case wallet.KindCanceled:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func kindOf(err error) string {
+	if errors.Is(err, errBadRequest) {
+		return wallet.KindValidation.String()
+	}
+	return wallet.KindOf(err).String()
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// decode reads JSON body of request, empty body leaves value unchanged
+func decode(r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(value)
+	if err != nil && err != io.EOF {
+		return badRequest(err.Error())
+	}
+	return nil
+}
+
+func badRequest(message string) error {
+	return fmt.Errorf("%w: %s", errBadRequest, message)
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+	"github.com/siavash-art/wallet/pkg/wallet"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(NewServer(&wallet.Service{}, t.TempDir()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends request with JSON body and decodes JSON response to result
+func do(t *testing.T, srv *httptest.Server, method string, path string, body interface{}, result interface{}) int {
+	t.Helper()
+	data := []byte{}
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	request, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := srv.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			t.Fatalf("%s %s: can't decode response, error = %v", method, path, err)
+		}
+	}
+	return response.StatusCode
+}
+
+func TestServer_payments(t *testing.T) {
+	srv := newTestServer(t)
+
+	account := types.Account{}
+	status := do(t, srv, http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638676"}, &account)
+	if status != http.StatusCreated || account.ID != 1 {
+		t.Errorf("POST /accounts: status = %v, account = %v", status, account)
+		return
+	}
+	status = do(t, srv, http.MethodPost, "/accounts/1/deposits", map[string]interface{}{"amount": 10_000_00}, &account)
+	if status != http.StatusOK || account.Balance != 10_000_00 {
+		t.Errorf("POST /accounts/1/deposits: status = %v, account = %v", status, account)
+	}
+
+	payment := types.Payment{}
+	status = do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 1_000_00, "category": "cat"}, &payment)
+	if status != http.StatusCreated || payment.Amount != 1_000_00 {
+		t.Errorf("POST /payments: status = %v, payment = %v", status, payment)
+		return
+	}
+
+	repeated := types.Payment{}
+	status = do(t, srv, http.MethodPost, "/payments/"+payment.ID+"/repeat", nil, &repeated)
+	if status != http.StatusCreated || repeated.ID == payment.ID {
+		t.Errorf("POST /payments/{id}/repeat: status = %v, payment = %v", status, repeated)
+	}
+	status = do(t, srv, http.MethodPost, "/payments/"+repeated.ID+"/reject", nil, &repeated)
+	if status != http.StatusOK || repeated.Status != types.PaymentStatusFail {
+		t.Errorf("POST /payments/{id}/reject: status = %v, payment = %v", status, repeated)
+	}
+
+	payments := []types.Payment{}
+	status = do(t, srv, http.MethodGet, "/accounts/1/payments", nil, &payments)
+	if status != http.StatusOK || len(payments) != 2 {
+		t.Errorf("GET /accounts/1/payments: status = %v, payments = %v", status, payments)
+	}
+	status = do(t, srv, http.MethodGet, "/accounts/1/payments?order=-amount", nil, &payments)
+	if status != http.StatusOK || len(payments) != 2 || payments[0].ID != payment.ID {
+		t.Errorf("GET /accounts/1/payments?order=-amount: status = %v, payments = %v", status, payments)
+	}
+	status = do(t, srv, http.MethodGet, "/accounts/1/payments?order=date", nil, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("GET /accounts/1/payments?order=date: status = %v", status)
+	}
+
+	report := types.Report{}
+	status = do(t, srv, http.MethodGet, "/accounts/1/report?period=month", nil, &report)
+	if status != http.StatusOK || report.Total != payment.Amount || len(report.Rows) != 1 || report.Rows[0].Category != "cat" {
+		t.Errorf("GET /accounts/1/report: status = %v, report = %+v", status, report)
+	}
+	status = do(t, srv, http.MethodGet, "/accounts/1/report?from=yesterday", nil, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("GET /accounts/1/report?from=yesterday: status = %v", status)
+	}
+
+	budget := types.Budget{}
+	status = do(t, srv, http.MethodPut, "/accounts/1/budgets/cat", map[string]interface{}{"amount": 1_000_00, "hard": true}, &budget)
+	if status != http.StatusOK || budget.Amount != 1_000_00 || !budget.Hard || len(budget.Thresholds) != 2 {
+		t.Errorf("PUT /accounts/1/budgets/cat: status = %v, budget = %+v", status, budget)
+	}
+	statuses := []types.BudgetStatus{}
+	status = do(t, srv, http.MethodGet, "/accounts/1/budgets", nil, &statuses)
+	if status != http.StatusOK || len(statuses) != 1 || statuses[0].Spent != payment.Amount {
+		t.Errorf("GET /accounts/1/budgets: status = %v, statuses = %+v", status, statuses)
+	}
+	status = do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 1_000_00, "category": "cat"}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("POST /payments: hard budget must block payment, status = %v", status)
+	}
+	status = do(t, srv, http.MethodDelete, "/accounts/1/budgets/cat", nil, &statuses)
+	if status != http.StatusOK || len(statuses) != 0 {
+		t.Errorf("DELETE /accounts/1/budgets/cat: status = %v, statuses = %+v", status, statuses)
+	}
+
+	page := wallet.PaymentPage{}
+	status = do(t, srv, http.MethodPost, "/payments/query", map[string]interface{}{"statuses": []string{"FAIL"}, "limit": 1}, &page)
+	if status != http.StatusOK || len(page.Payments) != 1 || page.Payments[0].ID != repeated.ID || page.NextCursor != "" {
+		t.Errorf("POST /payments/query: status = %v, page = %v", status, page)
+	}
+	status = do(t, srv, http.MethodPost, "/payments/query", map[string]interface{}{"cursor": "x"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("POST /payments/query: must reject cursor, status = %v", status)
+	}
+
+	favorite := types.Favorite{}
+	status = do(t, srv, http.MethodPost, "/favorites", map[string]interface{}{"payment_id": payment.ID, "name": "cat food"}, &favorite)
+	if status != http.StatusCreated || favorite.Name != "cat food" {
+		t.Errorf("POST /favorites: status = %v, favorite = %v", status, favorite)
+		return
+	}
+	status = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/pay", map[string]interface{}{"amount": 500_00}, &payment)
+	if status != http.StatusCreated || payment.Amount != 500_00 || payment.FavoriteID != favorite.ID {
+		t.Errorf("POST /favorites/{id}/pay: status = %v, payment = %v", status, payment)
+	}
+
+	favorites := []types.Favorite{}
+	status = do(t, srv, http.MethodGet, "/accounts/1/favorites", nil, &favorites)
+	if status != http.StatusOK || len(favorites) != 1 {
+		t.Errorf("GET /accounts/1/favorites: status = %v, favorites = %v", status, favorites)
+	}
+
+	status = do(t, srv, http.MethodGet, "/accounts/1", nil, &account)
+	if status != http.StatusOK || account.Balance != 8_500_00 {
+		t.Errorf("GET /accounts/1: status = %v, account = %v", status, account)
+	}
+
+	do(t, srv, http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638677"}, nil)
+	merchant := types.Merchant{}
+	status = do(t, srv, http.MethodPost, "/merchants", map[string]interface{}{"name": "Pet Shop", "category": "cat", "settlement_account_id": 2}, &merchant)
+	if status != http.StatusCreated || merchant.ID == "" || merchant.SettlementAccountID != 2 {
+		t.Errorf("POST /merchants: status = %v, merchant = %+v", status, merchant)
+		return
+	}
+	status = do(t, srv, http.MethodPost, "/merchants/"+merchant.ID+"/payments", map[string]interface{}{"account_id": 1, "amount": 100_00}, &payment)
+	if status != http.StatusCreated || payment.MerchantID != merchant.ID {
+		t.Errorf("POST /merchants/{id}/payments: status = %v, payment = %+v", status, payment)
+	}
+	status = do(t, srv, http.MethodGet, "/merchants/"+merchant.ID+"/payments", nil, &payments)
+	if status != http.StatusOK || len(payments) != 1 {
+		t.Errorf("GET /merchants/{id}/payments: status = %v, payments = %v", status, payments)
+	}
+	settlement := types.Settlement{}
+	status = do(t, srv, http.MethodPost, "/merchants/"+merchant.ID+"/settlements", nil, &settlement)
+	if status != http.StatusCreated || settlement.Amount != 100_00 || settlement.AccountID != 2 {
+		t.Errorf("POST /merchants/{id}/settlements: status = %v, settlement = %+v", status, settlement)
+	}
+	settlementReport := types.SettlementReport{}
+	status = do(t, srv, http.MethodGet, "/merchants/"+merchant.ID+"/report?from=2000-01-01T00:00:00Z", nil, &settlementReport)
+	if status != http.StatusOK || settlementReport.Gross != 100_00 || settlementReport.Settled != 100_00 || settlementReport.Balance != 0 {
+		t.Errorf("GET /merchants/{id}/report: status = %v, report = %+v", status, settlementReport)
+	}
+	status = do(t, srv, http.MethodGet, "/merchants/unknown", nil, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("GET /merchants/unknown: status = %v", status)
+	}
+
+	category := types.Category{}
+	status = do(t, srv, http.MethodPut, "/categories/Pets", map[string]interface{}{"name": "Pets", "aliases": []string{"cat"}}, &category)
+	if status != http.StatusOK || category.ID != "pets" || len(category.Aliases) != 1 {
+		t.Errorf("PUT /categories/Pets: status = %v, category = %+v", status, category)
+	}
+	migration := types.CategoryMigration{}
+	status = do(t, srv, http.MethodPost, "/categories/migrate", nil, &migration)
+	if status != http.StatusOK || migration.Changed != 6 || len(migration.Unresolved) != 0 {
+		t.Errorf("POST /categories/migrate: status = %v, migration = %+v", status, migration)
+	}
+	categories := []types.Category{}
+	status = do(t, srv, http.MethodGet, "/categories", nil, &categories)
+	if status != http.StatusOK || len(categories) != 1 {
+		t.Errorf("GET /categories: status = %v, categories = %+v", status, categories)
+	}
+	status = do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 1, "category": "dog"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("POST /payments: unknown category must be rejected, status = %v", status)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	srv := newTestServer(t)
+	do(t, srv, http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638676"}, nil)
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		kind   string
+	}{
+		{http.MethodGet, "/accounts/2", nil, http.StatusNotFound, "not found"},
+		{http.MethodGet, "/accounts/x", nil, http.StatusBadRequest, "validation"},
+		{http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638676"}, http.StatusConflict, "conflict"},
+		{http.MethodPost, "/accounts", map[string]interface{}{"phone": 1}, http.StatusBadRequest, "validation"},
+		{http.MethodPost, "/accounts/1/deposits", map[string]interface{}{"amount": -1}, http.StatusBadRequest, "validation"},
+		{http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 1, "category": "cat"}, http.StatusUnprocessableEntity, "insufficient funds"},
+		{http.MethodGet, "/payments/unknown", nil, http.StatusNotFound, "not found"},
+		{http.MethodDelete, "/accounts/1", nil, http.StatusMethodNotAllowed, "validation"},
+		{http.MethodGet, "/unknown", nil, http.StatusNotFound, "not found"},
+	}
+	for _, test := range tests {
+		response := errorResponse{}
+		status := do(t, srv, test.method, test.path, test.body, &response)
+		if status != test.status || response.Kind != test.kind {
+			t.Errorf("%s %s: status = %v, response = %v", test.method, test.path, status, response)
+		}
+	}
+
+	account := types.Account{}
+	do(t, srv, http.MethodPost, "/accounts/1/freeze", nil, &account)
+	if account.Status != types.AccountStatusFrozen {
+		t.Errorf("POST /accounts/1/freeze: account = %v", account)
+	}
+	response := errorResponse{}
+	status := do(t, srv, http.MethodPost, "/accounts/1/deposits", map[string]interface{}{"amount": 1}, &response)
+	if status != http.StatusForbidden {
+		t.Errorf("POST /accounts/1/deposits: status = %v, response = %v", status, response)
+	}
+}
+
+func TestServer_exportImport(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(NewServer(&wallet.Service{}, dir))
+	defer srv.Close()
+	do(t, srv, http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638676"}, nil)
+
+	status := do(t, srv, http.MethodPost, "/export", nil, nil)
+	if status != http.StatusOK {
+		t.Errorf("POST /export: status = %v", status)
+		return
+	}
+
+	imported := httptest.NewServer(NewServer(&wallet.Service{}, dir))
+	defer imported.Close()
+	status = do(t, imported, http.MethodPost, "/import", nil, nil)
+	if status != http.StatusOK {
+		t.Errorf("POST /import: status = %v", status)
+	}
+	account := types.Account{}
+	status = do(t, imported, http.MethodGet, "/accounts/1", nil, &account)
+	if status != http.StatusOK || account.Phone != "+992938638676" {
+		t.Errorf("GET /accounts/1: status = %v, account = %v", status, account)
+	}
+}
+
+func TestServer_importTwice(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(NewServer(&wallet.Service{}, dir))
+	defer srv.Close()
+	do(t, srv, http.MethodPost, "/accounts", map[string]interface{}{"phone": "+992938638676"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposits", map[string]interface{}{"amount": 1000}, nil)
+	do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 100, "category": "food"}, nil)
+	if status := do(t, srv, http.MethodPost, "/export", nil, nil); status != http.StatusOK {
+		t.Errorf("POST /export: status = %v", status)
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := do(t, srv, http.MethodPost, "/import", nil, nil); status != http.StatusOK {
+			t.Errorf("POST /import: status = %v", status)
+			return
+		}
+	}
+	payments := []types.Payment{}
+	status := do(t, srv, http.MethodGet, "/accounts/1/payments", nil, &payments)
+	if status != http.StatusOK || len(payments) != 1 {
+		t.Errorf("GET /accounts/1/payments: status = %v, payments = %v", status, payments)
+	}
+	account := types.Account{}
+	status = do(t, srv, http.MethodGet, "/accounts/2", nil, &account)
+	if status != http.StatusNotFound {
+		t.Errorf("GET /accounts/2: accounts must not be repeated, status = %v, account = %v", status, account)
+	}
+}
+
+func TestServer_payCredential(t *testing.T) {
+	svc := &wallet.Service{}
+	account, _ := svc.RegisterAccount("+992938638676")
+	svc.Deposit(account.ID, 1000)
+	svc.SetPIN(account.ID, "1234", types.Credential{})
+	srv := httptest.NewServer(NewServer(svc, t.TempDir()))
+	defer srv.Close()
+
+	status := do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 100, "category": "food"}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("POST /payments: credential must be required, status = %v", status)
+	}
+	payment := types.Payment{}
+	status = do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"account_id": 1, "amount": 100, "category": "food", "pin": "1234"}, &payment)
+	if status != http.StatusCreated || payment.Amount != 100 {
+		t.Errorf("POST /payments: status = %v, payment = %v", status, payment)
+	}
+}
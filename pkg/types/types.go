@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 //Money is type money
 type Money int64
 
@@ -11,39 +13,305 @@ type PaymentStatus string
 
 //Status categories
 const (
-	PaymentStatusOk         PaymentStatus = "OK"
-	PaymentStatusFail       PaymentStatus = "FAIL"
-	PaymentStatusInProgress PaymentStatus = "INPROGRESS"
+	PaymentStatusOk                PaymentStatus = "OK"
+	PaymentStatusFail              PaymentStatus = "FAIL"
+	PaymentStatusInProgress        PaymentStatus = "INPROGRESS"
+	PaymentStatusRefunded          PaymentStatus = "REFUNDED"
+	PaymentStatusPartiallyRefunded PaymentStatus = "PARTIALLYREFUNDED"
 )
 
-//Payment struct
+//Payment struct, FavoriteID is set when payment is made from favorite,
+//MerchantID when it is paid to merchant, Fee is charged in addition to Amount
 type Payment struct {
-	ID       string
+	ID         string          `json:"id"`
+	AccountID  int64           `json:"account_id"`
+	Amount     Money           `json:"amount"`
+	Category   PaymentCategory `json:"category"`
+	Status     PaymentStatus   `json:"status"`
+	FavoriteID string          `json:"favorite_id,omitempty"`
+	MerchantID string          `json:"merchant_id,omitempty"`
+	Fee        Money           `json:"fee,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+//FeeRule fee of payments in Category, empty Category is the rule of other
+//categories, fee is Fixed plus BasisPoints of amount limited by Min and Max,
+//zero Max means no limit
+type FeeRule struct {
+	Category    PaymentCategory `json:"category"`
+	Fixed       Money           `json:"fixed"`
+	BasisPoints int64           `json:"basis_points"`
+	Min         Money           `json:"min"`
+	Max         Money           `json:"max"`
+}
+
+//Credential confirms operations of account with PIN and one-time password
+type Credential struct {
+	PIN string
+	OTP string
+}
+
+//PhoneChange previous phone of account
+type PhoneChange struct {
+	AccountID int64
+	OldPhone  Phone
+	NewPhone  Phone
+	ChangedAt time.Time
+}
+
+//AuditRecord record of the audit log, TargetID is the other account of
+//transfers. Hash covers the record and PrevHash so records form a chain
+type AuditRecord struct {
+	Seq                 int64
+	Time                time.Time
+	Actor               string
+	Operation           string
+	AccountID           int64
+	TargetID            int64
+	Args                string
+	Outcome             string
+	BalanceBefore       Money
+	BalanceAfter        Money
+	TargetBalanceBefore Money
+	TargetBalanceAfter  Money
+	PrevHash            string
+	Hash                string
+}
+
+//Refund returned part of the payment
+type Refund struct {
+	ID        string
+	PaymentID string
 	AccountID int64
-	Amount   Money
-	Category PaymentCategory
-	Status   PaymentStatus
+	Amount    Money
 }
 
 //Phone payments phone
 type Phone string
 
-//Account struct
+//AccountStatus accounts status
+type AccountStatus string
+
+//Account status categories
+const (
+	AccountStatusActive AccountStatus = "ACTIVE"
+	AccountStatusFrozen AccountStatus = "FROZEN"
+	AccountStatusClosed AccountStatus = "CLOSED"
+)
+
+//Account struct, Balance is the ledger balance and Held is reserved by holds.
+//TransferredTo is the account which got balance of closed account
 type Account struct {
-	ID      int64
-	Phone   Phone
-	Balance Money
+	ID            int64         `json:"id"`
+	Phone         Phone         `json:"phone"`
+	Balance       Money         `json:"balance"`
+	Held          Money         `json:"held"`
+	Status        AccountStatus `json:"status"`
+	TransferredTo int64         `json:"transferred_to,omitempty"`
 }
 
-type Favorite struct {
+//Available balance which is not reserved by holds
+func (a *Account) Available() Money {
+	return a.Balance - a.Held
+}
+
+//HoldStatus holds status
+type HoldStatus string
+
+//Hold status categories
+const (
+	HoldStatusActive   HoldStatus = "ACTIVE"
+	HoldStatusCaptured HoldStatus = "CAPTURED"
+	HoldStatusVoided   HoldStatus = "VOIDED"
+	HoldStatusExpired  HoldStatus = "EXPIRED"
+)
+
+//Hold funds reserved by an authorization
+type Hold struct {
 	ID        string
 	AccountID int64
-	Name      string
 	Amount    Money
 	Category  PaymentCategory
+	Status    HoldStatus
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+//Favorite payment template, MinAmount and MaxAmount limit the amount
+//which can be paid from it, zero means no limit
+type Favorite struct {
+	ID        string          `json:"id"`
+	AccountID int64           `json:"account_id"`
+	Name      string          `json:"name"`
+	Amount    Money           `json:"amount"`
+	Category  PaymentCategory `json:"category"`
+	MinAmount Money           `json:"min_amount,omitempty"`
+	MaxAmount Money           `json:"max_amount,omitempty"`
+}
+
+//FavoriteUsage how many payments were made from favorite
+type FavoriteUsage struct {
+	FavoriteID string
+	Count      int
+	Total      Money
+}
+
+//Category of payments in registry, Parent is the ID of the enclosing
+//category (empty for top categories) and Aliases are other names of it
+type Category struct {
+	ID      PaymentCategory `json:"id"`
+	Name    string          `json:"name"`
+	Parent  PaymentCategory `json:"parent,omitempty"`
+	Aliases []string        `json:"aliases,omitempty"`
 }
 
+//CategoryMigration result of rewriting free text categories to registry IDs,
+//Unresolved categories match no category and are left as they are
+type CategoryMigration struct {
+	Changed    int               `json:"changed"`
+	Unresolved []PaymentCategory `json:"unresolved"`
+}
+
+//Merchant receives payments in Category, Balance is owed to merchant until
+//it is settled to SettlementAccountID
+type Merchant struct {
+	ID                  string          `json:"id"`
+	Name                string          `json:"name"`
+	Category            PaymentCategory `json:"category"`
+	SettlementAccountID int64           `json:"settlement_account_id"`
+	Balance             Money           `json:"balance"`
+}
+
+//Settlement moves Amount from balance of merchant to its settlement account
+type Settlement struct {
+	ID         string    `json:"id"`
+	MerchantID string    `json:"merchant_id"`
+	AccountID  int64     `json:"account_id"`
+	Amount     Money     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+//SettlementReport payments of merchant made in From..To, Net is Gross without
+//refunds of payments and Settled is sum of settlements in the same time
+type SettlementReport struct {
+	MerchantID string    `json:"merchant_id"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Count      int       `json:"count"`
+	Gross      Money     `json:"gross"`
+	Refunded   Money     `json:"refunded"`
+	Net        Money     `json:"net"`
+	Settled    Money     `json:"settled"`
+	Balance    Money     `json:"balance"`
+}
+
+//Budget monthly limit of spending of account in Category, Thresholds are
+//percents of Amount which raise alerts and Hard budget blocks payments above Amount
+type Budget struct {
+	AccountID  int64           `json:"account_id"`
+	Category   PaymentCategory `json:"category"`
+	Amount     Money           `json:"amount"`
+	Thresholds []int           `json:"thresholds"`
+	Hard       bool            `json:"hard"`
+}
+
+//BudgetStatus spending of budget in Month like "2020-01", Reached are
+//thresholds which are reached by Spent
+type BudgetStatus struct {
+	Budget
+	Month     string `json:"month"`
+	Spent     Money  `json:"spent"`
+	Remaining Money  `json:"remaining"`
+	Reached   []int  `json:"reached"`
+}
+
+//BudgetAlert is raised when payment makes spending of budget reach Threshold
+type BudgetAlert struct {
+	AccountID int64           `json:"account_id"`
+	Category  PaymentCategory `json:"category"`
+	Month     string          `json:"month"`
+	Threshold int             `json:"threshold"`
+	Spent     Money           `json:"spent"`
+	Amount    Money           `json:"amount"`
+	PaymentID string          `json:"payment_id"`
+}
+
+//ReportPeriod splits spending report by time, empty period splits only by category
+type ReportPeriod string
+
+//Report periods
+const (
+	ReportPeriodNone  ReportPeriod = ""
+	ReportPeriodDay   ReportPeriod = "day"
+	ReportPeriodWeek  ReportPeriod = "week"
+	ReportPeriodMonth ReportPeriod = "month"
+)
+
+//Report spending of account, payments of From..To are included, zero
+//time means no bound. Rows are sorted by Period and then by Total
+type Report struct {
+	AccountID int64        `json:"account_id"`
+	Period    ReportPeriod `json:"period,omitempty"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Total     Money        `json:"total"`
+	Count     int          `json:"count"`
+	Rows      []ReportRow  `json:"rows"`
+}
+
+//ReportRow spending in Category during Period like "2020-01-02", "2020-W01"
+//or "2020-01", Share is part of spending of the period from 0 to 1
+type ReportRow struct {
+	Period   string          `json:"period,omitempty"`
+	Category PaymentCategory `json:"category"`
+	Total    Money           `json:"total"`
+	Count    int             `json:"count"`
+	Share    float64         `json:"share"`
+}
+
+//Progress of computation by parts, Processed payments of Total are done.
+//Value is result of the part or of all parts when Final is set, Result
+//is the same when Value is Money
 type Progress struct {
-	Part int
-	Result Money
-}
\ No newline at end of file
+	Part      int
+	Processed int
+	Total     int
+	Result    Money
+	Value     interface{}
+	Final     bool
+}
+
+//Schedule recurring payment, it pays the favorite or Amount in Category
+//at times described by Spec. Start is the first run, @monthly runs keep its day
+type Schedule struct {
+	ID         string
+	AccountID  int64
+	FavoriteID string
+	Amount     Money
+	Category   PaymentCategory
+	Spec       string
+	Start      time.Time
+	NextRun    time.Time
+	RetryAt    time.Time
+	Attempts   int
+	Active     bool
+}
+
+//ScheduleRunStatus schedule runs status
+type ScheduleRunStatus string
+
+//Schedule run status categories
+const (
+	ScheduleRunOk    ScheduleRunStatus = "OK"
+	ScheduleRunRetry ScheduleRunStatus = "RETRY"
+	ScheduleRunFail  ScheduleRunStatus = "FAIL"
+)
+
+//ScheduleRun outcome of a single schedule execution
+type ScheduleRun struct {
+	ScheduleID string
+	Time       time.Time
+	PaymentID  string
+	Status     ScheduleRunStatus
+	Error      string
+}
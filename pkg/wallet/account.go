@@ -0,0 +1,149 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrAccountFrozen = errors.New("account is frozen")
+var ErrAccountClosed = errors.New("account is closed")
+var ErrAccountNotEmpty = errors.New("account balance must be zero or transferred")
+var ErrAccountHasHolds = errors.New("account has active holds")
+var ErrSameAccount = errors.New("can not transfer to the same account")
+
+// Accounts returns all accounts in the order of registration
+func (s *Service) Accounts() []types.Account {
+	accounts := make([]types.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, *account)
+	}
+	return accounts
+}
+
+// FreezeAccount blocks all operations with account money until it is unfrozen
+func (s *Service) FreezeAccount(accountID int64) (err error) {
+	defer wrapError(&err, "FreezeAccount", accountID, "")
+	defer s.startAudit("FreezeAccount", accountID, 0).finish(&err)
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	if account.Status == types.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	account.Status = types.AccountStatusFrozen
+	return nil
+}
+
+// UnfreezeAccount makes frozen account active again
+func (s *Service) UnfreezeAccount(accountID int64) (err error) {
+	defer wrapError(&err, "UnfreezeAccount", accountID, "")
+	defer s.startAudit("UnfreezeAccount", accountID, 0).finish(&err)
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	if account.Status == types.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	account.Status = types.AccountStatusActive
+	return nil
+}
+
+// CloseAccount closes account, the balance must be zero or it is transferred
+// to transferTo account, zero transferTo means no transfer. Later refunds and
+// rejects of its payments are credited to transferTo account too. Frozen
+// accounts must be unfrozen first, so their money can not leave. Accounts
+// with credential must use CloseAccountWithCredential
+func (s *Service) CloseAccount(accountID int64, transferTo int64) error {
+	return s.closeAccount(accountID, transferTo, nil)
+}
+
+// CloseAccountWithCredential closes account confirmed by credential
+func (s *Service) CloseAccountWithCredential(accountID int64, transferTo int64, auth types.Credential) error {
+	return s.closeAccount(accountID, transferTo, &auth)
+}
+
+// closeAccount checks credential which is always required if account has one
+func (s *Service) closeAccount(accountID int64, transferTo int64, auth *types.Credential) (err error) {
+	defer wrapError(&err, "CloseAccount", accountID, "")
+	defer s.startAudit("CloseAccount", accountID, transferTo).finish(&err)
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	if err = checkAccountStatus(account); err != nil {
+		return err
+	}
+	if err = s.authorizeOperation(accountID, auth, true); err != nil {
+		return err
+	}
+
+	s.expireHolds()
+	if account.Held != 0 {
+		return ErrAccountHasHolds
+	}
+
+	if account.Balance != 0 && transferTo == 0 {
+		return ErrAccountNotEmpty
+	}
+	if transferTo != 0 {
+		if transferTo == accountID {
+			return ErrSameAccount
+		}
+		var target *types.Account
+		target, err = s.FindAccountByID(transferTo)
+		if err != nil {
+			return err
+		}
+		err = checkAccountStatus(target)
+		if err != nil {
+			return err
+		}
+
+		target.Balance += account.Balance
+		account.Balance = 0
+		account.TransferredTo = target.ID
+	}
+
+	account.Status = types.AccountStatusClosed
+	for _, schedule := range s.schedules {
+		if schedule.AccountID == accountID {
+			schedule.Active = false
+		}
+	}
+	return nil
+}
+
+// creditedAccount returns account which gets money returned to account,
+// money of closed account goes to the account its balance was transferred to
+func (s *Service) creditedAccount(account *types.Account) (*types.Account, error) {
+	for account.Status == types.AccountStatusClosed {
+		if account.TransferredTo == 0 {
+			return nil, ErrAccountClosed
+		}
+		next, err := s.FindAccountByID(account.TransferredTo)
+		if err != nil {
+			return nil, err
+		}
+		account = next
+	}
+	return account, nil
+}
+
+// checkAccountStatus returns error if the account money can not be used
+func checkAccountStatus(account *types.Account) error {
+	switch account.Status {
+	case types.AccountStatusFrozen:
+		return ErrAccountFrozen
+	case types.AccountStatusClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_FreezeAccount_rejectsOperations(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "school")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	err = s.FreezeAccount(account.ID)
+	if err != nil {
+		t.Errorf("FreezeAccount(): error = %v", err)
+		return
+	}
+
+	if _, err = s.Pay(account.ID, 10_00, "food"); !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("Pay(): must return ErrAccountFrozen, returned = %v", err)
+	}
+	if err = s.Deposit(account.ID, 10_00); !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("Deposit(): must return ErrAccountFrozen, returned = %v", err)
+	}
+	if _, err = s.Repeat(payments[0].ID); !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("Repeat(): must return ErrAccountFrozen, returned = %v", err)
+	}
+	if _, err = s.PayFromFavorite(favorite.ID); !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("PayFromFavorite(): must return ErrAccountFrozen, returned = %v", err)
+	}
+
+	err = s.UnfreezeAccount(account.ID)
+	if err != nil {
+		t.Errorf("UnfreezeAccount(): error = %v", err)
+		return
+	}
+	if _, err = s.Pay(account.ID, 10_00, "food"); err != nil {
+		t.Errorf("Pay(): error = %v", err)
+	}
+}
+
+func TestService_CloseAccount_transfer(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, err := s.RegisterAccount("+992938638677")
+	if err != nil {
+		t.Errorf("RegisterAccount(): error = %v", err)
+		return
+	}
+
+	err = s.CloseAccount(account.ID, 0)
+	if !errors.Is(err, ErrAccountNotEmpty) {
+		t.Errorf("CloseAccount(): must return ErrAccountNotEmpty, returned = %v", err)
+	}
+
+	err = s.CloseAccount(account.ID, target.ID)
+	if err != nil {
+		t.Errorf("CloseAccount(): error = %v", err)
+		return
+	}
+	if account.Balance != 0 || target.Balance != 9_000_00 {
+		t.Errorf("CloseAccount(): wrong balances = %v, %v", account.Balance, target.Balance)
+	}
+
+	if err = s.Deposit(account.ID, 10_00); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("Deposit(): must return ErrAccountClosed, returned = %v", err)
+	}
+	if err = s.UnfreezeAccount(account.ID); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("UnfreezeAccount(): must return ErrAccountClosed, returned = %v", err)
+	}
+}
+
+func TestService_CloseAccount_frozen(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, err := s.RegisterAccount("+992938638677")
+	if err != nil {
+		t.Errorf("RegisterAccount(): error = %v", err)
+		return
+	}
+	if err = s.FreezeAccount(account.ID); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = s.CloseAccount(account.ID, target.ID)
+	if !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("CloseAccount(): must return ErrAccountFrozen, returned = %v", err)
+	}
+	if account.Balance != 9_000_00 || target.Balance != 0 || account.Status != types.AccountStatusFrozen {
+		t.Errorf("CloseAccount(): account = %v, target = %v", account, target)
+	}
+}
+
+func TestService_FreezeAccount_exportImport(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.FreezeAccount(account.ID)
+	if err != nil {
+		t.Errorf("FreezeAccount(): error = %v", err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = s.Export(dir)
+	if err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	svc := &Service{}
+	err = svc.Import(dir)
+	if err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+
+	got, err := svc.FindAccountByID(account.ID)
+	if err != nil {
+		t.Errorf("FindAccountByID(): error = %v", err)
+		return
+	}
+	if got.Status != types.AccountStatusFrozen {
+		t.Errorf("Import(): wrong status = %v", got.Status)
+	}
+}
+
+func TestService_CloseAccount_laterRefunds(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, _ := s.RegisterAccount("+992938638677")
+	second, _ := s.Pay(account.ID, 100_00, "food")
+	if err = s.CloseAccount(account.ID, target.ID); err != nil {
+		t.Errorf("CloseAccount(): error = %v", err)
+		return
+	}
+
+	refund, err := s.Refund(payments[0].ID, 100)
+	if err != nil || refund.AccountID != target.ID {
+		t.Errorf("Refund(): refund = %v, error = %v", refund, err)
+	}
+	if err = s.Reject(second.ID); err != nil {
+		t.Errorf("Reject(): error = %v", err)
+	}
+	if account.Balance != 0 || target.Balance != 8_900_00+100+100_00 {
+		t.Errorf("Refund(): closed account must not be credited, account = %v, target = %v", account, target)
+	}
+
+	// without transfer there is no account to credit
+	empty, _ := s.RegisterAccount("+992938638678")
+	s.Deposit(empty.ID, 100_00)
+	payment, _ := s.Pay(empty.ID, 100_00, "food")
+	if err = s.CloseAccount(empty.ID, 0); err != nil {
+		t.Errorf("CloseAccount(): error = %v", err)
+		return
+	}
+	if err = s.Reject(payment.ID); !errors.Is(err, ErrAccountClosed) || empty.Balance != 0 {
+		t.Errorf("Reject(): must return ErrAccountClosed, balance = %v, returned = %v", empty.Balance, err)
+	}
+
+	dir := t.TempDir()
+	if err = s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err = imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if closed, _ := imported.FindAccountByID(account.ID); closed.TransferredTo != target.ID {
+		t.Errorf("Import(): account = %v", closed)
+	}
+}
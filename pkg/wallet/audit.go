@@ -0,0 +1,338 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrAuditTampered = errors.New("audit log hash chain is broken")
+
+const defaultActor = "system"
+const auditOutcomeOk = "OK"
+
+// auditEntry is an operation which is recorded to audit log when it finishes
+type auditEntry struct {
+	s            *Service
+	operation    string
+	accountID    int64
+	targetID     int64
+	args         string
+	before       types.Money
+	targetBefore types.Money
+}
+
+// SetActor sets who performs the following operations, it is written to audit log
+func (s *Service) SetActor(actor string) {
+	s.actor = actor
+}
+
+// AuditLog returns audit records of account, also as target of transfers, in
+// time range, zero accountID means all accounts and zero from or to means no limit
+func (s *Service) AuditLog(accountID int64, from time.Time, to time.Time) []types.AuditRecord {
+	var records []types.AuditRecord
+	for _, record := range s.auditLog {
+		if accountID != 0 && record.AccountID != accountID && record.TargetID != accountID {
+			continue
+		}
+		if !from.IsZero() && record.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !record.Time.Before(to) {
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records
+}
+
+// ExportAudit writes audit log to file
+func (s *Service) ExportAudit(path string) (err error) {
+	defer wrapError(&err, "ExportAudit", 0, "")
+
+	return writeDump(path, s.auditRecords())
+}
+
+// ReadAudit reads audit log written by ExportAudit
+func ReadAudit(path string) ([]types.AuditRecord, error) {
+	lines, err := readDump(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseAudit(lines)
+}
+
+// auditRecords converts audit log to dump records, texts are escaped because
+// they may have ;
+func (s *Service) auditRecords() [][]string {
+	records := make([][]string, 0, len(s.auditLog))
+	for _, record := range s.auditLog {
+		records = append(records, []string{
+			strconv.FormatInt(record.Seq, 10),
+			strconv.FormatInt(record.Time.UnixNano(), 10),
+			url.PathEscape(record.Actor),
+			record.Operation,
+			strconv.FormatInt(record.AccountID, 10),
+			url.PathEscape(record.Args),
+			url.PathEscape(record.Outcome),
+			fmt.Sprint(record.BalanceBefore),
+			fmt.Sprint(record.BalanceAfter),
+			record.PrevHash,
+			record.Hash,
+			strconv.FormatInt(record.TargetID, 10),
+			fmt.Sprint(record.TargetBalanceBefore),
+			fmt.Sprint(record.TargetBalanceAfter),
+		})
+	}
+	return records
+}
+
+// importAudit restores audit log from dump records, the hash chain must be unbroken
+func (s *Service) importAudit(lines [][]string) error {
+	records, err := parseAudit(lines)
+	if err != nil {
+		return err
+	}
+	if err = VerifyAudit(records); err != nil {
+		return err
+	}
+	for i := range records {
+		s.auditLog = append(s.auditLog, &records[i])
+	}
+	return nil
+}
+
+// parseAudit parses dump records of audit log, records written before
+// targets were recorded have 11 fields
+func parseAudit(lines [][]string) ([]types.AuditRecord, error) {
+	records := make([]types.AuditRecord, 0, len(lines))
+	for _, value := range lines {
+		if len(value) != 11 && len(value) != 14 {
+			return nil, fmt.Errorf("%w: wrong record %v", ErrAuditTampered, value)
+		}
+		seq, err := strconv.ParseInt(value[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		nanos, err := strconv.ParseInt(value[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		accountID, err := strconv.ParseInt(value[4], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		before, err := strconv.ParseInt(value[7], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		after, err := strconv.ParseInt(value[8], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		actor, err := url.PathUnescape(value[2])
+		if err != nil {
+			return nil, err
+		}
+		args, err := url.PathUnescape(value[5])
+		if err != nil {
+			return nil, err
+		}
+		outcome, err := url.PathUnescape(value[6])
+		if err != nil {
+			return nil, err
+		}
+
+		record := types.AuditRecord{
+			Seq:           seq,
+			Time:          time.Unix(0, nanos),
+			Actor:         actor,
+			Operation:     value[3],
+			AccountID:     accountID,
+			Args:          args,
+			Outcome:       outcome,
+			BalanceBefore: types.Money(before),
+			BalanceAfter:  types.Money(after),
+			PrevHash:      value[9],
+			Hash:          value[10],
+		}
+		if len(value) == 14 {
+			record.TargetID, err = strconv.ParseInt(value[11], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			targetBefore, err := strconv.ParseInt(value[12], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			targetAfter, err := strconv.ParseInt(value[13], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			record.TargetBalanceBefore = types.Money(targetBefore)
+			record.TargetBalanceAfter = types.Money(targetAfter)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// VerifyAudit checks that records form an unbroken hash chain
+func VerifyAudit(records []types.AuditRecord) error {
+	prev := ""
+	for i, record := range records {
+		if record.Seq != int64(i+1) || record.PrevHash != prev || record.Hash != auditHash(record) {
+			return fmt.Errorf("%w: at record %d", ErrAuditTampered, record.Seq)
+		}
+		prev = record.Hash
+	}
+	return nil
+}
+
+// startAudit captures balances of account and target account, which gets
+// money of transfers and is zero otherwise, before the operation. The record
+// is appended by finish, so methods use it as
+//
+//	defer s.startAudit("Deposit", accountID, 0, amount).finish(&err)
+func (s *Service) startAudit(operation string, accountID int64, targetID int64, args ...interface{}) *auditEntry {
+	values := make([]string, 0, len(args))
+	for _, arg := range args {
+		values = append(values, fmt.Sprint(arg))
+	}
+	return &auditEntry{
+		s:            s,
+		operation:    operation,
+		accountID:    accountID,
+		targetID:     targetID,
+		args:         strings.Join(values, ","),
+		before:       s.balanceOf(accountID),
+		targetBefore: s.balanceOf(targetID),
+	}
+}
+
+// finish appends the record with the operation outcome to audit log
+func (e *auditEntry) finish(err *error) {
+	s := e.s
+	outcome := auditOutcomeOk
+	if err != nil && *err != nil {
+		outcome = (*err).Error()
+	}
+	actor := s.actor
+	if actor == "" {
+		actor = defaultActor
+	}
+
+	record := &types.AuditRecord{
+		Seq:           int64(len(s.auditLog) + 1),
+		Time:          s.currentTime(),
+		Actor:         actor,
+		Operation:     e.operation,
+		AccountID:     e.accountID,
+		Args:          e.args,
+		Outcome:       outcome,
+		BalanceBefore: e.before,
+		BalanceAfter:  s.balanceOf(e.accountID),
+	}
+	if e.targetID != 0 {
+		record.TargetID = e.targetID
+		record.TargetBalanceBefore = e.targetBefore
+		record.TargetBalanceAfter = s.balanceOf(e.targetID)
+	}
+	if len(s.auditLog) != 0 {
+		record.PrevHash = s.auditLog[len(s.auditLog)-1].Hash
+	}
+	record.Hash = auditHash(*record)
+	s.auditLog = append(s.auditLog, record)
+}
+
+func (s *Service) balanceOf(accountID int64) types.Money {
+	for _, account := range s.accounts {
+		if account.ID == accountID {
+			return account.Balance
+		}
+	}
+	return 0
+}
+
+// accountOfPayment returns account of payment or zero if payment is not found
+func (s *Service) accountOfPayment(paymentID string) int64 {
+	for _, payment := range s.payments {
+		if payment.ID == paymentID {
+			return payment.AccountID
+		}
+	}
+	return 0
+}
+
+// accountOfFavorite returns account of favorite or zero if favorite is not found
+func (s *Service) accountOfFavorite(favoriteID string) int64 {
+	for _, favorite := range s.favorites {
+		if favorite.ID == favoriteID {
+			return favorite.AccountID
+		}
+	}
+	return 0
+}
+
+// accountOfHold returns account of hold or zero if hold is not found
+func (s *Service) accountOfHold(holdID string) int64 {
+	for _, hold := range s.holds {
+		if hold.ID == holdID {
+			return hold.AccountID
+		}
+	}
+	return 0
+}
+
+// accountOfSchedule returns account of schedule or zero if schedule is not found
+func (s *Service) accountOfSchedule(scheduleID string) int64 {
+	for _, schedule := range s.schedules {
+		if schedule.ID == scheduleID {
+			return schedule.AccountID
+		}
+	}
+	return 0
+}
+
+// accountOfMerchant returns settlement account of merchant or zero if merchant is not found
+func (s *Service) accountOfMerchant(merchantID string) int64 {
+	for _, merchant := range s.merchants {
+		if merchant.ID == merchantID {
+			return merchant.SettlementAccountID
+		}
+	}
+	return 0
+}
+
+// auditHash hashes record with PrevHash, target fields are added only when
+// there is target, so records written before them keep their hashes
+func auditHash(record types.AuditRecord) string {
+	fields := []string{
+		record.PrevHash,
+		strconv.FormatInt(record.Seq, 10),
+		strconv.FormatInt(record.Time.UnixNano(), 10),
+		record.Actor,
+		record.Operation,
+		strconv.FormatInt(record.AccountID, 10),
+		record.Args,
+		record.Outcome,
+		fmt.Sprint(record.BalanceBefore),
+		fmt.Sprint(record.BalanceAfter),
+	}
+	if record.TargetID != 0 {
+		fields = append(fields,
+			strconv.FormatInt(record.TargetID, 10),
+			fmt.Sprint(record.TargetBalanceBefore),
+			fmt.Sprint(record.TargetBalanceAfter),
+		)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_AuditLog_records(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	s.SetActor("operator")
+
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	now = now.Add(time.Hour)
+	err = s.Reject(payments[0].ID)
+	if err != nil {
+		t.Errorf("Reject(): error = %v", err)
+		return
+	}
+	_, err = s.Pay(account.ID, 100_000_00, "car")
+	if !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+		return
+	}
+
+	records := s.AuditLog(account.ID, time.Time{}, time.Time{})
+	operations := []string{"RegisterAccount", "Deposit", "Pay", "Reject", "Pay"}
+	if len(records) != len(operations) {
+		t.Errorf("AuditLog(): wrong records = %v", records)
+		return
+	}
+	for i, operation := range operations {
+		if records[i].Operation != operation || records[i].Actor != "operator" {
+			t.Errorf("AuditLog(): wrong record = %v", records[i])
+		}
+	}
+	if records[3].BalanceBefore != 9_000_00 || records[3].BalanceAfter != 10_000_00 {
+		t.Errorf("AuditLog(): wrong balances of Reject = %v", records[3])
+	}
+	if records[4].Outcome != ErrNotEnoughBalance.Error() {
+		t.Errorf("AuditLog(): wrong outcome = %v", records[4].Outcome)
+	}
+
+	later := s.AuditLog(account.ID, now, time.Time{})
+	if len(later) != 2 {
+		t.Errorf("AuditLog(): wrong records in time range = %v", later)
+	}
+}
+
+func TestService_ExportAudit_verify(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// failed operations are audited too, args and outcome have separators of dumps
+	_, err = s.FavoritePayment(payments[0].ID, "school; university")
+	if !errors.Is(err, ErrInvalidFavoriteName) {
+		t.Errorf("FavoritePayment(): must return ErrInvalidFavoriteName, returned = %v", err)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.dump")
+	err = s.ExportAudit(path)
+	if err != nil {
+		t.Errorf("ExportAudit(): error = %v", err)
+		return
+	}
+	records, err := ReadAudit(path)
+	if err != nil {
+		t.Errorf("ReadAudit(): error = %v", err)
+		return
+	}
+	if len(records) != 4 || records[3].Args != payments[0].ID+",school; university" || !strings.Contains(records[3].Outcome, ErrInvalidFavoriteName.Error()) {
+		t.Errorf("ReadAudit(): wrong records = %v", records)
+		return
+	}
+
+	err = VerifyAudit(records)
+	if err != nil {
+		t.Errorf("VerifyAudit(): error = %v", err)
+	}
+
+	records[1].BalanceAfter += 1_000_00
+	err = VerifyAudit(records)
+	if !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAudit(): must return ErrAuditTampered, returned = %v", err)
+	}
+}
+
+func TestService_Transfer_auditTarget(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, _ := s.RegisterAccount("+992938638677")
+	s.Deposit(target.ID, 100_00)
+	if err := s.Transfer(account.ID, target.ID, 10_00, types.Credential{}); err != nil {
+		t.Errorf("Transfer(): error = %v", err)
+		return
+	}
+	if err := s.CloseAccount(target.ID, account.ID); err != nil {
+		t.Errorf("CloseAccount(): error = %v", err)
+		return
+	}
+
+	records := s.AuditLog(target.ID, time.Time{}, time.Time{})
+	operations := []string{"RegisterAccount", "Deposit", "Transfer", "CloseAccount"}
+	if len(records) != len(operations) {
+		t.Errorf("AuditLog(): wrong records = %v", records)
+		return
+	}
+	for i, operation := range operations {
+		if records[i].Operation != operation {
+			t.Errorf("AuditLog(): wrong record = %v", records[i])
+		}
+	}
+	transfer := records[2]
+	if transfer.AccountID != account.ID || transfer.TargetID != target.ID || transfer.TargetBalanceBefore != 100_00 || transfer.TargetBalanceAfter != 110_00 {
+		t.Errorf("AuditLog(): wrong transfer = %+v", transfer)
+	}
+	closing := records[3]
+	if closing.TargetID != account.ID || closing.BalanceAfter != 0 || closing.TargetBalanceAfter != 9_100_00 {
+		t.Errorf("AuditLog(): wrong close = %+v", closing)
+	}
+}
+
+func TestService_Export_audit(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, _ := s.RegisterAccount("+992938638677")
+	s.Transfer(account.ID, target.ID, 10_00, types.Credential{})
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	records := imported.AuditLog(0, time.Time{}, time.Time{})
+	if len(records) != len(s.auditLog)+1 || records[len(records)-1].Operation != "Import" || records[4].TargetID != target.ID {
+		t.Errorf("Import(): wrong audit log = %v", records)
+	}
+	if err := VerifyAudit(records); err != nil {
+		t.Errorf("VerifyAudit(): error = %v", err)
+	}
+
+	// tampered log is not imported
+	path := filepath.Join(dir, "audit.dump")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte(strings.Replace(string(content), "RegisterAccount", "Deposit", 1)), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := newTestService()
+	if err := tampered.Import(dir); !errors.Is(err, ErrAuditTampered) || len(tampered.accounts) != 0 {
+		t.Errorf("Import(): must return ErrAuditTampered, accounts = %v, returned = %v", len(tampered.accounts), err)
+	}
+}
@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidBudget = errors.New("invalid budget")
+var ErrBudgetNotFound = errors.New("budget not found")
+var ErrBudgetExceeded = errors.New("payment exceeds hard budget")
+
+// defaultBudgetThresholds are used when budget has no thresholds
+var defaultBudgetThresholds = []int{80, 100}
+
+// BudgetNotifier receives alerts of budgets
+type BudgetNotifier interface {
+	NotifyBudget(alert types.BudgetAlert)
+}
+
+// BudgetNotifierFunc calls function for every alert
+type BudgetNotifierFunc func(alert types.BudgetAlert)
+
+// NotifyBudget calls f
+func (f BudgetNotifierFunc) NotifyBudget(alert types.BudgetAlert) {
+	f(alert)
+}
+
+// SetBudgetNotifier sets the receiver of budget alerts, alerts are logged anyway
+func (s *Service) SetBudgetNotifier(notifier BudgetNotifier) {
+	s.budgetAlerts = notifier
+}
+
+// SetBudget sets monthly budget of account in category, the previous budget
+// of the category is replaced. Thresholds are sorted, none means 80% and 100%
+func (s *Service) SetBudget(budget types.Budget) (result *types.Budget, err error) {
+	defer wrapError(&err, "SetBudget", budget.AccountID, "")
+	defer s.startAudit("SetBudget", budget.AccountID, 0, budget.Category, budget.Amount, budget.Thresholds, budget.Hard).finish(&err)
+
+	if _, err = s.FindAccountByID(budget.AccountID); err != nil {
+		return nil, err
+	}
+	if budget.Category == "" {
+		return nil, fmt.Errorf("%w: category is required", ErrInvalidBudget)
+	}
+	if budget.Category, err = s.resolveCategory(budget.Category); err != nil {
+		return nil, err
+	}
+	if budget.Amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+	thresholds := append([]int(nil), budget.Thresholds...)
+	if len(thresholds) == 0 {
+		thresholds = append(thresholds, defaultBudgetThresholds...)
+	}
+	sort.Ints(thresholds)
+	for i, threshold := range thresholds {
+		if threshold <= 0 || i > 0 && threshold == thresholds[i-1] {
+			return nil, fmt.Errorf("%w: thresholds must be positive and different", ErrInvalidBudget)
+		}
+	}
+	budget.Thresholds = thresholds
+
+	if found, ok := s.findBudget(budget.AccountID, budget.Category); ok {
+		*found = budget
+		return found, nil
+	}
+	result = &budget
+	s.budgets = append(s.budgets, result)
+	return result, nil
+}
+
+// RemoveBudget removes budget of account in category
+func (s *Service) RemoveBudget(accountID int64, category types.PaymentCategory) (err error) {
+	defer wrapError(&err, "RemoveBudget", accountID, "")
+	defer s.startAudit("RemoveBudget", accountID, 0, category).finish(&err)
+
+	if found, ok := s.lookupCategory(string(category)); ok {
+		category = found.ID
+	}
+	for i, budget := range s.budgets {
+		if budget.AccountID == accountID && budget.Category == category {
+			s.budgets = append(s.budgets[:i], s.budgets[i+1:]...)
+			return nil
+		}
+	}
+	return ErrBudgetNotFound
+}
+
+// Budgets returns budgets of account sorted by category
+func (s *Service) Budgets(accountID int64) (budgets []types.Budget, err error) {
+	defer wrapError(&err, "Budgets", accountID, "")
+
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	budgets = []types.Budget{}
+	for _, budget := range s.budgets {
+		if budget.AccountID == accountID {
+			budgets = append(budgets, *budget)
+		}
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		return budgets[i].Category < budgets[j].Category
+	})
+	return budgets, nil
+}
+
+// BudgetStatus returns spending of budgets of account in the current month
+func (s *Service) BudgetStatus(accountID int64) (statuses []types.BudgetStatus, err error) {
+	defer wrapError(&err, "BudgetStatus", accountID, "")
+
+	budgets, err := s.Budgets(accountID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.currentTime()
+	statuses = make([]types.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		spent := s.budgetSpent(accountID, budget.Category, now)
+		status := types.BudgetStatus{
+			Budget:  budget,
+			Month:   now.Format("2006-01"),
+			Spent:   spent,
+			Reached: []int{},
+		}
+		if spent < budget.Amount {
+			status.Remaining = budget.Amount - spent
+		}
+		for _, threshold := range budget.Thresholds {
+			if reached(spent, budget.Amount, threshold) {
+				status.Reached = append(status.Reached, threshold)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// findBudget returns budget of account in category
+func (s *Service) findBudget(accountID int64, category types.PaymentCategory) (*types.Budget, bool) {
+	for _, budget := range s.budgets {
+		if budget.AccountID == accountID && budget.Category == category {
+			return budget, true
+		}
+	}
+	return nil, false
+}
+
+// budgetSpent sums payments of account in category made in the month of now,
+// failed payments are skipped and refunds are taken off amounts
+func (s *Service) budgetSpent(accountID int64, category types.PaymentCategory, now time.Time) types.Money {
+	month := now.Format("2006-01")
+	spent := types.Money(0)
+	for _, i := range s.updatePaymentIndex().byAccount[accountID] {
+		payment := s.payments[i]
+		if payment.Category != category || payment.Status == types.PaymentStatusFail {
+			continue
+		}
+		if payment.CreatedAt.In(now.Location()).Format("2006-01") != month {
+			continue
+		}
+		spent += payment.Amount - s.refundedAmount(payment.ID)
+	}
+	return spent
+}
+
+// reached checks that spent is at least threshold percents of amount
+func reached(spent types.Money, amount types.Money, threshold int) bool {
+	return spent*100 >= amount*types.Money(threshold)
+}
+
+// checkBudget blocks payment which makes spending exceed hard budget, it
+// returns spending of the budget before payment
+func (s *Service) checkBudget(accountID int64, category types.PaymentCategory, amount types.Money) (types.Money, error) {
+	budget, ok := s.findBudget(accountID, category)
+	if !ok {
+		return 0, nil
+	}
+	spent := s.budgetSpent(accountID, category, s.currentTime())
+	if budget.Hard && spent+amount > budget.Amount {
+		return spent, fmt.Errorf("%w: spent %d of %d", ErrBudgetExceeded, spent, budget.Amount)
+	}
+	return spent, nil
+}
+
+// alertBudget raises alerts of thresholds reached by payment
+func (s *Service) alertBudget(payment *types.Payment, spent types.Money) {
+	budget, ok := s.findBudget(payment.AccountID, payment.Category)
+	if !ok {
+		return
+	}
+	for _, threshold := range budget.Thresholds {
+		if reached(spent, budget.Amount, threshold) || !reached(spent+payment.Amount, budget.Amount, threshold) {
+			continue
+		}
+		alert := types.BudgetAlert{
+			AccountID: payment.AccountID,
+			Category:  payment.Category,
+			Month:     payment.CreatedAt.Format("2006-01"),
+			Threshold: threshold,
+			Spent:     spent + payment.Amount,
+			Amount:    budget.Amount,
+			PaymentID: payment.ID,
+		}
+		s.log().Warn("budget threshold reached", "account_id", alert.AccountID, "category", alert.Category, "threshold", threshold, "spent", alert.Spent, "budget", alert.Amount)
+		if s.budgetAlerts != nil {
+			s.budgetAlerts.NotifyBudget(alert)
+		}
+	}
+}
+
+// budgetRecords converts budgets to dump records
+func (s *Service) budgetRecords() [][]string {
+	records := make([][]string, 0, len(s.budgets))
+	for _, budget := range s.budgets {
+		thresholds := make([]string, 0, len(budget.Thresholds))
+		for _, threshold := range budget.Thresholds {
+			thresholds = append(thresholds, strconv.Itoa(threshold))
+		}
+		records = append(records, []string{
+			strconv.FormatInt(budget.AccountID, 10),
+			string(budget.Category),
+			strconv.FormatInt(int64(budget.Amount), 10),
+			strings.Join(thresholds, ","),
+			strconv.FormatBool(budget.Hard),
+		})
+	}
+	return records
+}
+
+// importBudgets restores budgets from dump records
+func (s *Service) importBudgets(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("budget record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		var thresholds []int
+		for _, field := range strings.Split(record[3], ",") {
+			threshold, err := strconv.Atoi(field)
+			if err != nil {
+				return err
+			}
+			thresholds = append(thresholds, threshold)
+		}
+		hard, err := strconv.ParseBool(record[4])
+		if err != nil {
+			return err
+		}
+		s.budgets = append(s.budgets, &types.Budget{
+			AccountID:  accountID,
+			Category:   types.PaymentCategory(record[1]),
+			Amount:     types.Money(amount),
+			Thresholds: thresholds,
+			Hard:       hard,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_SetBudget_alerts(t *testing.T) {
+	s := &Service{}
+	now := time.Date(2020, 1, 30, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	account, _ := s.RegisterAccount("+992938638676")
+	s.Deposit(account.ID, 100_000)
+
+	var alerts []types.BudgetAlert
+	s.SetBudgetNotifier(BudgetNotifierFunc(func(alert types.BudgetAlert) {
+		alerts = append(alerts, alert)
+	}))
+	budget, err := s.SetBudget(types.Budget{AccountID: account.ID, Category: "food", Amount: 1000})
+	if err != nil || !reflect.DeepEqual(budget.Thresholds, []int{80, 100}) {
+		t.Errorf("SetBudget(): budget = %v, error = %v", budget, err)
+		return
+	}
+
+	s.Pay(account.ID, 500, "food")
+	s.Pay(account.ID, 500, "auto")
+	if len(alerts) != 0 {
+		t.Errorf("Pay(): must not alert, alerts = %v", alerts)
+	}
+	payment, _ := s.Pay(account.ID, 300, "food")
+	if len(alerts) != 1 || alerts[0].Threshold != 80 || alerts[0].Spent != 800 || alerts[0].PaymentID != payment.ID {
+		t.Errorf("Pay(): wrong alerts = %v", alerts)
+	}
+	_, err = s.Pay(account.ID, 400, "food")
+	if err != nil || len(alerts) != 2 || alerts[1].Threshold != 100 {
+		t.Errorf("Pay(): soft budget must allow payment, alerts = %v, error = %v", alerts, err)
+	}
+
+	statuses, err := s.BudgetStatus(account.ID)
+	want := []types.BudgetStatus{{Budget: *budget, Month: "2020-01", Spent: 1200, Reached: []int{80, 100}}}
+	if err != nil || !reflect.DeepEqual(statuses, want) {
+		t.Errorf("BudgetStatus(): statuses = %+v, error = %v", statuses, err)
+	}
+
+	// spending of the new month starts from zero
+	now = time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	statuses, _ = s.BudgetStatus(account.ID)
+	if statuses[0].Spent != 0 || statuses[0].Remaining != 1000 || len(statuses[0].Reached) != 0 {
+		t.Errorf("BudgetStatus(): wrong status of new month = %+v", statuses[0])
+	}
+}
+
+func TestService_SetBudget_hard(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.SetBudget(types.Budget{AccountID: account.ID, Category: "cat", Amount: 1_500_00, Thresholds: []int{100, 50}, Hard: true})
+	if err != nil {
+		t.Errorf("SetBudget(): error = %v", err)
+		return
+	}
+
+	_, err = s.Pay(account.ID, 500_01, "cat")
+	if !errors.Is(err, ErrBudgetExceeded) || KindOf(err) != KindForbidden {
+		t.Errorf("Pay(): must return ErrBudgetExceeded, returned = %v", err)
+	}
+	if _, err := s.Pay(account.ID, 500_00, "cat"); err != nil {
+		t.Errorf("Pay(): error = %v", err)
+	}
+	// rejected payments do not count
+	if err := s.Reject(payments[0].ID); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Pay(account.ID, 1_000_00, "cat"); err != nil {
+		t.Errorf("Pay(): error = %v", err)
+	}
+
+	if err := s.RemoveBudget(account.ID, "cat"); err != nil {
+		t.Errorf("RemoveBudget(): error = %v", err)
+	}
+	if _, err := s.Pay(account.ID, 1_000_00, "cat"); err != nil {
+		t.Errorf("Pay(): budget is removed, error = %v", err)
+	}
+	if err := s.RemoveBudget(account.ID, "cat"); !errors.Is(err, ErrBudgetNotFound) {
+		t.Errorf("RemoveBudget(): must return ErrBudgetNotFound, returned = %v", err)
+	}
+}
+
+func TestService_SetBudget_invalid(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tests := []struct {
+		budget types.Budget
+		err    error
+	}{
+		{types.Budget{AccountID: 100, Category: "cat", Amount: 1}, ErrAccountNotFound},
+		{types.Budget{AccountID: account.ID, Amount: 1}, ErrInvalidBudget},
+		{types.Budget{AccountID: account.ID, Category: "cat"}, ErrAmountMustBePositive},
+		{types.Budget{AccountID: account.ID, Category: "cat", Amount: 1, Thresholds: []int{50, 0}}, ErrInvalidBudget},
+		{types.Budget{AccountID: account.ID, Category: "cat", Amount: 1, Thresholds: []int{50, 50}}, ErrInvalidBudget},
+	}
+	for _, test := range tests {
+		_, err := s.SetBudget(test.budget)
+		if !errors.Is(err, test.err) {
+			t.Errorf("SetBudget(%+v): must return %v, returned = %v", test.budget, test.err, err)
+		}
+	}
+}
+
+func TestService_Export_budgets(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "cat", Amount: 1000, Hard: true})
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "auto", Amount: 500, Thresholds: []int{50}})
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	want, _ := s.Budgets(account.ID)
+	got, err := imported.Budgets(account.ID)
+	if err != nil || len(got) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Import(): budgets = %v, want %v, error = %v", got, want, err)
+	}
+
+	// removed budgets must not come back from the old dump
+	imported.RemoveBudget(account.ID, "cat")
+	imported.RemoveBudget(account.ID, "auto")
+	if err := imported.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	reimported := &Service{}
+	if err := reimported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if got, _ := reimported.Budgets(account.ID); len(got) != 0 {
+		t.Errorf("Import(): removed budgets = %v", got)
+	}
+}
+
+func TestService_SetBudget_hardHolds(t *testing.T) {
+	s := &Service{}
+	now := time.Date(2020, 1, 30, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	account, _ := s.RegisterAccount("+992938638676")
+	s.Deposit(account.ID, 100_000)
+	var alerts []types.BudgetAlert
+	s.SetBudgetNotifier(BudgetNotifierFunc(func(alert types.BudgetAlert) {
+		alerts = append(alerts, alert)
+	}))
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "food", Amount: 1000, Hard: true})
+
+	first, err := s.Authorize(account.ID, 700, "food")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+	if _, err = s.Authorize(account.ID, 400, "food"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Authorize(): active holds must count, returned = %v", err)
+	}
+	second, err := s.Authorize(account.ID, 300, "food")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+	if _, err = s.Capture(first.ID, 700); err != nil || len(alerts) != 0 {
+		t.Errorf("Capture(): alerts = %v, error = %v", alerts, err)
+	}
+
+	// payment can not spend budget reserved by the hold
+	if _, err = s.Pay(account.ID, 200, "food"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Pay(): must return ErrBudgetExceeded, returned = %v", err)
+	}
+	if account.Balance != 100_000-700 || account.Held != 300 {
+		t.Errorf("Pay(): account must not change, balance = %v, held = %v", account.Balance, account.Held)
+	}
+	payment, err := s.Capture(second.ID, 300)
+	if err != nil || len(alerts) != 2 || alerts[1].Threshold != 100 || alerts[1].PaymentID != payment.ID {
+		t.Errorf("Capture(): alerts = %v, error = %v", alerts, err)
+	}
+}
@@ -0,0 +1,328 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidCategory = errors.New("invalid category")
+var ErrUnknownCategory = errors.New("unknown category")
+var ErrCategoryConflict = errors.New("category name is taken")
+
+// maxSuggestDistance is the largest number of typos of unknown category
+// which still suggests the closest name
+const maxSuggestDistance = 2
+
+// RegisterCategory adds category to registry or replaces the category with
+// the same ID. IDs and aliases are matched ignoring case and extra spaces, so
+// they are kept lower case. Parent must be registered before its children
+func (s *Service) RegisterCategory(category types.Category) (result *types.Category, err error) {
+	defer wrapError(&err, "RegisterCategory", 0, "")
+	defer s.startAudit("RegisterCategory", 0, 0, category.ID, category.Name, category.Parent, category.Aliases).finish(&err)
+
+	category.ID = types.PaymentCategory(normalizeCategory(string(category.ID)))
+	if category.ID == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidCategory)
+	}
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		category.Name = string(category.ID)
+	}
+	if strings.ContainsAny(string(category.ID)+category.Name, ";\n") {
+		return nil, fmt.Errorf("%w: %q has ; or line break", ErrInvalidCategory, category.ID)
+	}
+	if owner := s.categoryOwner(string(category.ID)); owner != nil && owner.ID != category.ID {
+		return nil, fmt.Errorf("%w: %q is alias of %q", ErrCategoryConflict, category.ID, owner.ID)
+	}
+
+	if category.Parent != "" {
+		parent, ok := s.lookupCategory(string(category.Parent))
+		if !ok {
+			return nil, fmt.Errorf("%w: parent %q", ErrUnknownCategory, category.Parent)
+		}
+		for ancestor := parent; ancestor != nil; ancestor = s.findCategory(ancestor.Parent) {
+			if ancestor.ID == category.ID {
+				return nil, fmt.Errorf("%w: %q can not be inside itself", ErrInvalidCategory, category.ID)
+			}
+		}
+		category.Parent = parent.ID
+	}
+
+	aliases := []string{}
+	seen := map[string]bool{string(category.ID): true}
+	for _, alias := range category.Aliases {
+		alias = normalizeCategory(alias)
+		if alias == "" || seen[alias] {
+			continue
+		}
+		if strings.ContainsAny(alias, ";,\n") {
+			return nil, fmt.Errorf("%w: alias %q has ; , or line break", ErrInvalidCategory, alias)
+		}
+		if owner := s.categoryOwner(alias); owner != nil && owner.ID != category.ID {
+			return nil, fmt.Errorf("%w: %q belongs to %q", ErrCategoryConflict, alias, owner.ID)
+		}
+		seen[alias] = true
+		aliases = append(aliases, alias)
+	}
+	category.Aliases = aliases
+
+	if found := s.findCategory(category.ID); found != nil {
+		*found = category
+		return found, nil
+	}
+	result = &category
+	s.categories = append(s.categories, result)
+	return result, nil
+}
+
+// Categories returns registry sorted by ID
+func (s *Service) Categories() []types.Category {
+	categories := make([]types.Category, 0, len(s.categories))
+	for _, category := range s.categories {
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].ID < categories[j].ID
+	})
+	return categories
+}
+
+// ResolveCategory returns ID of category named by ID or alias in any case,
+// while registry is empty every category is free text and returned as is
+func (s *Service) ResolveCategory(name types.PaymentCategory) (category types.PaymentCategory, err error) {
+	defer wrapError(&err, "ResolveCategory", 0, "")
+
+	return s.resolveCategory(name)
+}
+
+// Subcategories returns ID of category and IDs of all categories inside it sorted
+func (s *Service) Subcategories(name types.PaymentCategory) (ids []types.PaymentCategory, err error) {
+	defer wrapError(&err, "Subcategories", 0, "")
+
+	root, ok := s.lookupCategory(string(name))
+	if !ok {
+		return nil, s.unknownCategory(name)
+	}
+	ids = []types.PaymentCategory{root.ID}
+	for i := 0; i < len(ids); i++ {
+		for _, category := range s.categories {
+			if category.Parent == ids[i] {
+				ids = append(ids, category.ID)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// MigrateCategories rewrites free text categories of payments, favorites,
+// holds, schedules, merchants and budgets to IDs of registry. Budgets which
+// become repeated are dropped, the first one is kept
+func (s *Service) MigrateCategories() (migration types.CategoryMigration, err error) {
+	defer wrapError(&err, "MigrateCategories", 0, "")
+	defer s.startAudit("MigrateCategories", 0, 0).finish(&err)
+
+	migration.Unresolved = []types.PaymentCategory{}
+	if len(s.categories) == 0 {
+		return migration, fmt.Errorf("%w: registry is empty", ErrInvalidCategory)
+	}
+	unresolved := map[types.PaymentCategory]bool{}
+	migrate := func(category *types.PaymentCategory) {
+		found, ok := s.lookupCategory(string(*category))
+		if !ok {
+			unresolved[*category] = true
+			return
+		}
+		if found.ID != *category {
+			*category = found.ID
+			migration.Changed++
+		}
+	}
+
+	for _, payment := range s.payments {
+		migrate(&payment.Category)
+	}
+	for _, favorite := range s.favorites {
+		migrate(&favorite.Category)
+	}
+	for _, hold := range s.holds {
+		migrate(&hold.Category)
+	}
+	for _, schedule := range s.schedules {
+		migrate(&schedule.Category)
+	}
+	for _, merchant := range s.merchants {
+		migrate(&merchant.Category)
+	}
+	budgets := s.budgets[:0]
+	for _, budget := range s.budgets {
+		migrate(&budget.Category)
+		if containsBudget(budgets, budget.AccountID, budget.Category) {
+			s.log().Warn("repeated budget dropped", "account_id", budget.AccountID, "category", budget.Category)
+			continue
+		}
+		budgets = append(budgets, budget)
+	}
+	s.budgets = budgets
+	s.paymentIndex = nil
+
+	for category := range unresolved {
+		migration.Unresolved = append(migration.Unresolved, category)
+	}
+	sort.Slice(migration.Unresolved, func(i, j int) bool {
+		return migration.Unresolved[i] < migration.Unresolved[j]
+	})
+	s.log().Info("categories migrated", "changed", migration.Changed, "unresolved", len(migration.Unresolved))
+	return migration, nil
+}
+
+// containsBudget checks that budgets have budget of account in category
+func containsBudget(budgets []*types.Budget, accountID int64, category types.PaymentCategory) bool {
+	for _, budget := range budgets {
+		if budget.AccountID == accountID && budget.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCategory returns ID of category, unknown category is error
+// unless registry is empty
+func (s *Service) resolveCategory(name types.PaymentCategory) (types.PaymentCategory, error) {
+	if len(s.categories) == 0 {
+		return name, nil
+	}
+	category, ok := s.lookupCategory(string(name))
+	if !ok {
+		return "", s.unknownCategory(name)
+	}
+	return category.ID, nil
+}
+
+// lookupCategory finds category by ID or alias
+func (s *Service) lookupCategory(name string) (*types.Category, bool) {
+	category := s.categoryOwner(normalizeCategory(name))
+	return category, category != nil
+}
+
+// categoryOwner returns category which has normalized name as ID or alias
+func (s *Service) categoryOwner(name string) *types.Category {
+	for _, category := range s.categories {
+		if string(category.ID) == name {
+			return category
+		}
+	}
+	for _, category := range s.categories {
+		for _, alias := range category.Aliases {
+			if alias == name {
+				return category
+			}
+		}
+	}
+	return nil
+}
+
+// findCategory returns category by exact ID
+func (s *Service) findCategory(id types.PaymentCategory) *types.Category {
+	if id == "" {
+		return nil
+	}
+	for _, category := range s.categories {
+		if category.ID == id {
+			return category
+		}
+	}
+	return nil
+}
+
+// unknownCategory makes ErrUnknownCategory which suggests the closest name
+func (s *Service) unknownCategory(name types.PaymentCategory) error {
+	normalized := normalizeCategory(string(name))
+	best, bestDistance := "", maxSuggestDistance+1
+	for _, category := range s.categories {
+		for _, candidate := range append([]string{string(category.ID)}, category.Aliases...) {
+			if distance := editDistance(normalized, candidate); distance < bestDistance {
+				best, bestDistance = string(category.ID), distance
+			}
+		}
+	}
+	if best == "" {
+		return fmt.Errorf("%w: %q", ErrUnknownCategory, name)
+	}
+	return fmt.Errorf("%w: %q, did you mean %q", ErrUnknownCategory, name, best)
+}
+
+// normalizeCategory lower cases name and collapses spaces
+func normalizeCategory(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// editDistance is the Levenshtein distance of a and b in runes
+func editDistance(a string, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
+
+// minInt returns the smaller of a and b
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// categoryRecords converts registry to dump records, aliases are separated by ,
+func (s *Service) categoryRecords() [][]string {
+	records := make([][]string, 0, len(s.categories))
+	for _, category := range s.categories {
+		records = append(records, []string{
+			string(category.ID),
+			category.Name,
+			string(category.Parent),
+			strings.Join(category.Aliases, ","),
+		})
+	}
+	return records
+}
+
+// importCategories restores registry from dump records
+func (s *Service) importCategories(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 4 {
+			return fmt.Errorf("category record has %d fields", len(record))
+		}
+		aliases := []string{}
+		if record[3] != "" {
+			aliases = strings.Split(record[3], ",")
+		}
+		s.categories = append(s.categories, &types.Category{
+			ID:      types.PaymentCategory(record[0]),
+			Name:    record[1],
+			Parent:  types.PaymentCategory(record[2]),
+			Aliases: aliases,
+		})
+	}
+	return nil
+}
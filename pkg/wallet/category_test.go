@@ -0,0 +1,205 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// newCategoryTestService registers food with restaurants and cafe inside it and auto
+func newCategoryTestService(t *testing.T) *Service {
+	s := &Service{}
+	categories := []types.Category{
+		{ID: "Food", Name: "Food", Aliases: []string{"Groceries", "meal"}},
+		{ID: "restaurants", Name: "Restaurants", Parent: "food", Aliases: []string{"dining"}},
+		{ID: "cafe", Parent: "restaurants"},
+		{ID: "auto", Name: "Auto", Aliases: []string{"car"}},
+	}
+	for _, category := range categories {
+		if _, err := s.RegisterCategory(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestService_RegisterCategory(t *testing.T) {
+	s := newCategoryTestService(t)
+
+	want := []types.Category{
+		{ID: "auto", Name: "Auto", Aliases: []string{"car"}},
+		{ID: "cafe", Name: "cafe", Parent: "restaurants", Aliases: []string{}},
+		{ID: "food", Name: "Food", Aliases: []string{"groceries", "meal"}},
+		{ID: "restaurants", Name: "Restaurants", Parent: "food", Aliases: []string{"dining"}},
+	}
+	if got := s.Categories(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Categories(): got = %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name types.PaymentCategory
+		id   types.PaymentCategory
+	}{
+		{"food", "food"},
+		{" FOOD ", "food"},
+		{"Groceries", "food"},
+		{"DINING", "restaurants"},
+	}
+	for _, test := range tests {
+		id, err := s.ResolveCategory(test.name)
+		if err != nil || id != test.id {
+			t.Errorf("ResolveCategory(%q): id = %q, want %q, error = %v", test.name, id, test.id, err)
+		}
+	}
+	_, err := s.ResolveCategory("fod")
+	if !errors.Is(err, ErrUnknownCategory) || KindOf(err) != KindValidation || !strings.Contains(err.Error(), `did you mean "food"`) {
+		t.Errorf("ResolveCategory(): must return ErrUnknownCategory with suggestion, returned = %v", err)
+	}
+
+	ids, err := s.Subcategories("Food")
+	if err != nil || !reflect.DeepEqual(ids, []types.PaymentCategory{"cafe", "food", "restaurants"}) {
+		t.Errorf("Subcategories(): ids = %v, error = %v", ids, err)
+	}
+
+	// replacing keeps the category in its place
+	if _, err := s.RegisterCategory(types.Category{ID: "auto", Name: "Cars", Aliases: []string{"car", "fuel"}}); err != nil {
+		t.Errorf("RegisterCategory(): error = %v", err)
+	}
+	if id, _ := s.ResolveCategory("fuel"); id != "auto" || len(s.categories) != 4 {
+		t.Errorf("RegisterCategory(): category is not replaced, categories = %+v", s.Categories())
+	}
+}
+
+func TestService_RegisterCategory_invalid(t *testing.T) {
+	s := newCategoryTestService(t)
+
+	tests := []struct {
+		category types.Category
+		err      error
+	}{
+		{types.Category{ID: " "}, ErrInvalidCategory},
+		{types.Category{ID: "pets;cats"}, ErrInvalidCategory},
+		{types.Category{ID: "pets", Aliases: []string{"cat,dog"}}, ErrInvalidCategory},
+		{types.Category{ID: "pets", Parent: "animals"}, ErrUnknownCategory},
+		{types.Category{ID: "food", Parent: "cafe"}, ErrInvalidCategory},
+		{types.Category{ID: "car"}, ErrCategoryConflict},
+		{types.Category{ID: "pets", Aliases: []string{"meal"}}, ErrCategoryConflict},
+		{types.Category{ID: "pets", Aliases: []string{"Auto"}}, ErrCategoryConflict},
+	}
+	for _, test := range tests {
+		_, err := s.RegisterCategory(test.category)
+		if !errors.Is(err, test.err) {
+			t.Errorf("RegisterCategory(%+v): must return %v, returned = %v", test.category, test.err, err)
+		}
+	}
+	if len(s.categories) != 4 {
+		t.Errorf("RegisterCategory(): registry must not change, categories = %+v", s.Categories())
+	}
+}
+
+func TestService_Pay_category(t *testing.T) {
+	s := newCategoryTestService(t)
+	account, _ := s.RegisterAccount("+992938638676")
+	s.Deposit(account.ID, 100_000)
+
+	payment, err := s.Pay(account.ID, 100, "Meal")
+	if err != nil || payment.Category != "food" {
+		t.Errorf("Pay(): payment = %v, error = %v", payment, err)
+		return
+	}
+	_, err = s.Pay(account.ID, 100, "fod")
+	if !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("Pay(): must return ErrUnknownCategory, returned = %v", err)
+	}
+	if account.Balance != 100_000-100 {
+		t.Errorf("Pay(): unknown category must not change balance, balance = %v", account.Balance)
+	}
+
+	// payments made before the registry are validated when added to favorites
+	s.payments = append(s.payments, &types.Payment{ID: "free-text", AccountID: account.ID, Amount: 100, Category: "Groceries"})
+	favorite, err := s.FavoritePayment("free-text", "Market")
+	if err != nil || favorite.Category != "food" {
+		t.Errorf("FavoritePayment(): favorite = %v, error = %v", favorite, err)
+	}
+	s.payments = append(s.payments, &types.Payment{ID: "unknown", AccountID: account.ID, Amount: 100, Category: "pets"})
+	_, err = s.FavoritePayment("unknown", "Pets")
+	if !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("FavoritePayment(): must return ErrUnknownCategory, returned = %v", err)
+	}
+
+	budget, err := s.SetBudget(types.Budget{AccountID: account.ID, Category: "CAR", Amount: 1000})
+	if err != nil || budget.Category != "auto" {
+		t.Errorf("SetBudget(): budget = %v, error = %v", budget, err)
+	}
+}
+
+func TestService_MigrateCategories(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s.Pay(account.ID, 100, "Food")
+	s.Pay(account.ID, 100, "groceries")
+	s.Pay(account.ID, 100, "pets")
+	s.FavoritePayment(payments[0].ID, "Cat food")
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "Food", Amount: 1000})
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "groceries", Amount: 2000})
+
+	if _, err := s.MigrateCategories(); !errors.Is(err, ErrInvalidCategory) {
+		t.Errorf("MigrateCategories(): empty registry must return ErrInvalidCategory, returned = %v", err)
+	}
+	s.RegisterCategory(types.Category{ID: "food", Aliases: []string{"groceries", "cat"}})
+
+	migration, err := s.MigrateCategories()
+	want := types.CategoryMigration{Changed: 6, Unresolved: []types.PaymentCategory{"pets"}}
+	if err != nil || !reflect.DeepEqual(migration, want) {
+		t.Errorf("MigrateCategories(): migration = %+v, want %+v, error = %v", migration, want, err)
+	}
+	page, err := s.QueryPayments(PaymentQuery{Categories: []types.PaymentCategory{"food"}})
+	if err != nil || len(page.Payments) != 3 {
+		t.Errorf("QueryPayments(): payments must be indexed again, payments = %v, error = %v", page.Payments, err)
+	}
+	budgets, _ := s.Budgets(account.ID)
+	if len(budgets) != 1 || budgets[0].Amount != 1000 {
+		t.Errorf("MigrateCategories(): repeated budget must be dropped, budgets = %+v", budgets)
+	}
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if got := imported.Categories(); !reflect.DeepEqual(got, s.Categories()) {
+		t.Errorf("Import(): categories = %+v, want %+v", got, s.Categories())
+	}
+}
+
+func TestService_UpdateFavorite_category(t *testing.T) {
+	s := newCategoryTestService(t)
+	account, _ := s.RegisterAccount("+992938638676")
+	s.Deposit(account.ID, 100_000)
+	payment, _ := s.Pay(account.ID, 100, "food")
+	favorite, err := s.FavoritePayment(payment.ID, "Market")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	if err = s.UpdateFavorite(favorite.ID, 200, "Car"); err != nil || favorite.Category != "auto" {
+		t.Errorf("UpdateFavorite(): favorite = %v, error = %v", favorite, err)
+	}
+	err = s.UpdateFavorite(favorite.ID, 300, "fod")
+	if !errors.Is(err, ErrUnknownCategory) || favorite.Amount != 200 || favorite.Category != "auto" {
+		t.Errorf("UpdateFavorite(): must return ErrUnknownCategory, favorite = %v, returned = %v", favorite, err)
+	}
+}
@@ -0,0 +1,17 @@
+package wallet
+
+import (
+	"context"
+)
+
+// Context variants are kept only for operations which loop over payments or
+// dump files, like ExportContext and SumPaymentsContext, and are next to their
+// plain versions. Other operations change the service at once and have none.
+
+// cancelCheckEvery is how many payments goroutines handle between checks of ctx
+const cancelCheckEvery = 1024
+
+// canceled is checked by loops over payments, ctx is looked at every cancelCheckEvery items
+func canceled(ctx context.Context, i int) bool {
+	return i%cancelCheckEvery == 0 && ctx.Err() != nil
+}
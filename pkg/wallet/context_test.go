@@ -0,0 +1,91 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestService_Context_canceled(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 3_000; i++ {
+		_, err = s.Pay(account.ID, 1, "cat")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = s.FilterPaymentsContext(ctx, account.ID, 4)
+	if !errors.Is(err, context.Canceled) || KindOf(err) != KindCanceled {
+		t.Errorf("FilterPaymentsContext(): must return context.Canceled, returned = %v", err)
+	}
+	_, err = s.SumPaymentsContext(ctx, 4)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SumPaymentsContext(): must return context.Canceled, returned = %v", err)
+	}
+
+	dir := t.TempDir()
+	err = s.ExportContext(ctx, dir)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ExportContext(): must return context.Canceled, returned = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "accounts.dump")); !os.IsNotExist(err) {
+		t.Errorf("ExportContext(): must not write files, error = %v", err)
+	}
+
+	results := 0
+	for range s.SumPaymentsWithProgressContext(ctx) {
+		results++
+	}
+	if results != 0 {
+		t.Errorf("SumPaymentsWithProgressContext(): wrong results = %v", results)
+	}
+}
+
+func TestService_Context_deadline(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sum, err := s.SumPaymentsContext(ctx, 2)
+	if err != nil || sum != 1_000_00 {
+		t.Errorf("SumPaymentsContext(): sum = %v, error = %v", sum, err)
+	}
+	payments, err := s.FilterPaymentsContext(ctx, account.ID, 2)
+	if err != nil || len(payments) != 1 {
+		t.Errorf("FilterPaymentsContext(): payments = %v, error = %v", payments, err)
+	}
+
+	dir := t.TempDir()
+	err = s.ExportContext(ctx, dir)
+	if err != nil {
+		t.Errorf("ExportContext(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	err = imported.ImportContext(ctx, dir)
+	if err != nil {
+		t.Errorf("ImportContext(): error = %v", err)
+	}
+	if len(imported.accounts) != 1 || len(imported.payments) != 1 {
+		t.Errorf("ImportContext(): wrong import = %v, %v", len(imported.accounts), len(imported.payments))
+	}
+}
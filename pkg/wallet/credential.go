@@ -0,0 +1,312 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidPIN = errors.New("pin must have from 4 to 8 digits")
+var ErrPINNotSet = errors.New("pin is not set")
+var ErrCredentialRequired = errors.New("credential required")
+var ErrInvalidCredential = errors.New("invalid credential")
+var ErrCredentialLocked = errors.New("credential locked after failed attempts")
+
+const maxCredentialFailures = 5
+const credentialLockout = 15 * time.Minute
+const totpStep = 30
+
+// pinHashCost is bcrypt cost of PIN hashes
+var pinHashCost = bcrypt.DefaultCost
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// preauthorized is given instead of credential by operations authorized
+// before they run, like runs of schedules authorized when they were created
+var preauthorized = &types.Credential{}
+
+// credential bcrypt hash of PIN and TOTP secret of account, lastStep is
+// the time step of the last accepted one-time password
+type credential struct {
+	pinHash     []byte
+	otpSecret   string
+	lastStep    int64
+	failures    int
+	lockedUntil time.Time
+}
+
+// SetAuthThreshold sets the amount above which payments of accounts
+// with credential must be confirmed
+func (s *Service) SetAuthThreshold(amount types.Money) {
+	s.authThreshold = amount
+}
+
+// SetPIN sets account PIN, current credential is required to change existing PIN
+func (s *Service) SetPIN(accountID int64, pin string, current types.Credential) (err error) {
+	defer wrapError(&err, "SetPIN", accountID, "")
+	defer s.startAudit("SetPIN", accountID, 0).finish(&err)
+
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return err
+	}
+	if len(pin) < 4 || len(pin) > 8 || strings.Trim(pin, "0123456789") != "" {
+		return ErrInvalidPIN
+	}
+
+	c, ok := s.credentials[accountID]
+	if ok {
+		if err = s.verifyCredential(c, current); err != nil {
+			return err
+		}
+	} else {
+		c = &credential{}
+	}
+
+	pinHash, err := bcrypt.GenerateFromPassword([]byte(pin), pinHashCost)
+	if err != nil {
+		return err
+	}
+	c.pinHash = pinHash
+
+	if s.credentials == nil {
+		s.credentials = map[int64]*credential{}
+	}
+	s.credentials[accountID] = c
+	return nil
+}
+
+// EnableOTP generates TOTP secret for account with PIN, after that
+// every credential must contain the current one-time password
+func (s *Service) EnableOTP(accountID int64, current types.Credential) (secret string, err error) {
+	defer wrapError(&err, "EnableOTP", accountID, "")
+	defer s.startAudit("EnableOTP", accountID, 0).finish(&err)
+
+	c, ok := s.credentials[accountID]
+	if !ok {
+		return "", ErrPINNotSet
+	}
+	if err = s.verifyCredential(c, current); err != nil {
+		return "", err
+	}
+
+	key := make([]byte, 20)
+	if _, err = rand.Read(key); err != nil {
+		return "", err
+	}
+	c.otpSecret = totpEncoding.EncodeToString(key)
+	return c.otpSecret, nil
+}
+
+// PayWithCredential makes payment confirmed by credential
+func (s *Service) PayWithCredential(accountID int64, amount types.Money, category types.PaymentCategory, auth types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "PayWithCredential", accountID, "")
+
+	return s.pay(accountID, amount, category, nil, "", &auth)
+}
+
+// FavoritePaymentWithCredential creates favorite confirmed by credential
+func (s *Service) FavoritePaymentWithCredential(paymentID string, name string, auth types.Credential) (favorite *types.Favorite, err error) {
+	defer wrapError(&err, "FavoritePaymentWithCredential", 0, paymentID)
+
+	return s.favoritePayment(paymentID, name, &auth)
+}
+
+// Transfer moves amount between accounts, it must be confirmed by credential
+// if the sender account has one
+func (s *Service) Transfer(fromID int64, toID int64, amount types.Money, auth types.Credential) (err error) {
+	defer wrapError(&err, "Transfer", fromID, "")
+	defer s.startAudit("Transfer", fromID, toID, amount).finish(&err)
+
+	if amount <= 0 {
+		return ErrAmountMustBePositive
+	}
+	if fromID == toID {
+		return ErrSameAccount
+	}
+
+	from, err := s.FindAccountByID(fromID)
+	if err != nil {
+		return err
+	}
+	to, err := s.FindAccountByID(toID)
+	if err != nil {
+		return err
+	}
+	if err = checkAccountStatus(from); err != nil {
+		return err
+	}
+	if err = checkAccountStatus(to); err != nil {
+		return err
+	}
+
+	err = s.authorizeOperation(fromID, &auth, true)
+	if err != nil {
+		return err
+	}
+
+	s.expireHolds()
+	if from.Available() < amount {
+		return ErrNotEnoughBalance
+	}
+
+	from.Balance -= amount
+	to.Balance += amount
+	return nil
+}
+
+// GenerateTOTP returns one-time password of secret at time t (RFC 6238)
+func GenerateTOTP(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/totpStep))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1_000_000), nil
+}
+
+// authorizeOperation verifies given credential, without it the operation
+// is allowed only if it is not required or account has no credential
+func (s *Service) authorizeOperation(accountID int64, given *types.Credential, required bool) error {
+	c, ok := s.credentials[accountID]
+	if !ok || given == preauthorized {
+		return nil
+	}
+	if given == nil {
+		if required {
+			return ErrCredentialRequired
+		}
+		return nil
+	}
+	return s.verifyCredential(c, *given)
+}
+
+// verifyCredential checks PIN and OTP and locks credential after repeated failures,
+// one-time password of the last accepted or earlier time step is not accepted again
+func (s *Service) verifyCredential(c *credential, given types.Credential) error {
+	now := s.currentTime()
+	if now.Before(c.lockedUntil) {
+		return ErrCredentialLocked
+	}
+
+	valid := bcrypt.CompareHashAndPassword(c.pinHash, []byte(given.PIN)) == nil
+	step := int64(0)
+	if valid && c.otpSecret != "" {
+		step, valid = validTOTP(c.otpSecret, given.OTP, now)
+		valid = valid && step > c.lastStep
+	}
+	if !valid {
+		c.failures++
+		if c.failures >= maxCredentialFailures {
+			c.failures = 0
+			c.lockedUntil = now.Add(credentialLockout)
+			return ErrCredentialLocked
+		}
+		return ErrInvalidCredential
+	}
+
+	c.failures = 0
+	if step > c.lastStep {
+		c.lastStep = step
+	}
+	return nil
+}
+
+// validTOTP accepts passwords of the current and adjacent time steps
+// and returns the time step of the matched one
+func validTOTP(secret string, otp string, now time.Time) (int64, bool) {
+	for _, offset := range []int64{-1, 0, 1} {
+		step := now.Unix()/totpStep + offset
+		code, err := GenerateTOTP(secret, time.Unix(step*totpStep, 0))
+		if err == nil && subtle.ConstantTimeCompare([]byte(code), []byte(otp)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// credentialRecords converts credentials to dump records, PIN is kept as bcrypt hash
+func (s *Service) credentialRecords() [][]string {
+	records := make([][]string, 0, len(s.credentials))
+	for _, account := range s.accounts {
+		c, ok := s.credentials[account.ID]
+		if !ok {
+			continue
+		}
+		lockedUntil := int64(0)
+		if !c.lockedUntil.IsZero() {
+			lockedUntil = c.lockedUntil.Unix()
+		}
+		records = append(records, []string{
+			strconv.FormatInt(account.ID, 10),
+			string(c.pinHash),
+			c.otpSecret,
+			strconv.FormatInt(c.lastStep, 10),
+			strconv.Itoa(c.failures),
+			strconv.FormatInt(lockedUntil, 10),
+		})
+	}
+	return records
+}
+
+// importCredentials restores credentials from dump records
+func (s *Service) importCredentials(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 6 {
+			return fmt.Errorf("credential record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		if _, err = bcrypt.Cost([]byte(record[1])); err != nil {
+			return err
+		}
+		lastStep, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		failures, err := strconv.Atoi(record[4])
+		if err != nil {
+			return err
+		}
+		lockedUntil, err := strconv.ParseInt(record[5], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		c := &credential{
+			pinHash:   []byte(record[1]),
+			otpSecret: record[2],
+			lastStep:  lastStep,
+			failures:  failures,
+		}
+		if lockedUntil != 0 {
+			c.lockedUntil = time.Unix(lockedUntil, 0)
+		}
+		if s.credentials == nil {
+			s.credentials = map[int64]*credential{}
+		}
+		s.credentials[accountID] = c
+	}
+	return nil
+}
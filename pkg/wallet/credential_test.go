@@ -0,0 +1,310 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_PayWithCredential_threshold(t *testing.T) {
+	s := newTestService()
+	s.SetAuthThreshold(100_00)
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.SetPIN(account.ID, "1234", types.Credential{})
+	if err != nil {
+		t.Errorf("SetPIN(): error = %v", err)
+		return
+	}
+
+	if _, err = s.Pay(account.ID, 100_00, "food"); err != nil {
+		t.Errorf("Pay(): error = %v", err)
+	}
+	if _, err = s.Pay(account.ID, 100_01, "food"); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("Pay(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.PayWithCredential(account.ID, 100_01, "food", types.Credential{PIN: "4321"}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("PayWithCredential(): must return ErrInvalidCredential, returned = %v", err)
+	}
+	if _, err = s.PayWithCredential(account.ID, 100_01, "food", types.Credential{PIN: "1234"}); err != nil {
+		t.Errorf("PayWithCredential(): error = %v", err)
+	}
+}
+
+func TestService_Transfer_lockout(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, err := s.RegisterAccount("+992938638677")
+	if err != nil {
+		t.Errorf("RegisterAccount(): error = %v", err)
+		return
+	}
+	err = s.SetPIN(account.ID, "1234", types.Credential{})
+	if err != nil {
+		t.Errorf("SetPIN(): error = %v", err)
+		return
+	}
+
+	for i := 1; i < maxCredentialFailures; i++ {
+		if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "0000"}); !errors.Is(err, ErrInvalidCredential) {
+			t.Errorf("Transfer(): must return ErrInvalidCredential, returned = %v", err)
+		}
+	}
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "0000"}); !errors.Is(err, ErrCredentialLocked) {
+		t.Errorf("Transfer(): must return ErrCredentialLocked, returned = %v", err)
+	}
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234"}); !errors.Is(err, ErrCredentialLocked) {
+		t.Errorf("Transfer(): must return ErrCredentialLocked, returned = %v", err)
+	}
+
+	now = now.Add(credentialLockout)
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234"}); err != nil {
+		t.Errorf("Transfer(): error = %v", err)
+		return
+	}
+	if target.Balance != 10_00 {
+		t.Errorf("Transfer(): wrong balance = %v", target.Balance)
+	}
+}
+
+func TestService_EnableOTP_favorite(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.SetPIN(account.ID, "1234", types.Credential{})
+	if err != nil {
+		t.Errorf("SetPIN(): error = %v", err)
+		return
+	}
+	secret, err := s.EnableOTP(account.ID, types.Credential{PIN: "1234"})
+	if err != nil {
+		t.Errorf("EnableOTP(): error = %v", err)
+		return
+	}
+
+	if _, err = s.FavoritePayment(payments[0].ID, "school"); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("FavoritePayment(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.FavoritePaymentWithCredential(payments[0].ID, "school", types.Credential{PIN: "1234"}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("FavoritePaymentWithCredential(): must return ErrInvalidCredential, returned = %v", err)
+	}
+
+	otp, err := GenerateTOTP(secret, now)
+	if err != nil {
+		t.Errorf("GenerateTOTP(): error = %v", err)
+		return
+	}
+	if _, err = s.FavoritePaymentWithCredential(payments[0].ID, "school", types.Credential{PIN: "1234", OTP: otp}); err != nil {
+		t.Errorf("FavoritePaymentWithCredential(): error = %v", err)
+	}
+}
+
+func TestService_EnableOTP_replay(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, _ := s.RegisterAccount("+992938638677")
+	s.SetPIN(account.ID, "1234", types.Credential{})
+	secret, err := s.EnableOTP(account.ID, types.Credential{PIN: "1234"})
+	if err != nil {
+		t.Errorf("EnableOTP(): error = %v", err)
+		return
+	}
+
+	otp, _ := GenerateTOTP(secret, now)
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234", OTP: otp}); err != nil {
+		t.Errorf("Transfer(): error = %v", err)
+		return
+	}
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234", OTP: otp}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("Transfer(): reused OTP must return ErrInvalidCredential, returned = %v", err)
+	}
+	previous, _ := GenerateTOTP(secret, now.Add(-totpStep*time.Second))
+	if err = s.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234", OTP: previous}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("Transfer(): OTP of earlier step must return ErrInvalidCredential, returned = %v", err)
+	}
+
+	dir := t.TempDir()
+	if err = s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	imported.SetClock(func() time.Time { return now })
+	if err = imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if err = imported.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234", OTP: otp}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("Import(): reused OTP must return ErrInvalidCredential, returned = %v", err)
+	}
+	next, _ := GenerateTOTP(secret, now.Add(totpStep*time.Second))
+	if err = imported.Transfer(account.ID, target.ID, 10_00, types.Credential{PIN: "1234", OTP: next}); err != nil {
+		t.Errorf("Import(): OTP of the next step must be accepted, error = %v", err)
+	}
+}
+
+func TestGenerateTOTP_rfc6238(t *testing.T) {
+	// test vector of RFC 6238 for SHA1 secret "12345678901234567890"
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	got, err := GenerateTOTP(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Errorf("GenerateTOTP(): error = %v", err)
+		return
+	}
+	if got != "287082" {
+		t.Errorf("GenerateTOTP(): want = 287082, got = %v", got)
+	}
+}
+
+func TestService_CloseAccount_credential(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	target, _ := s.RegisterAccount("+992938638677")
+	s.SetPIN(account.ID, "1234", types.Credential{})
+
+	if err = s.CloseAccount(account.ID, target.ID); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("CloseAccount(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if err = s.CloseAccountWithCredential(account.ID, target.ID, types.Credential{PIN: "0000"}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("CloseAccountWithCredential(): must return ErrInvalidCredential, returned = %v", err)
+	}
+	if account.Balance != 9_000_00 || target.Balance != 0 || account.Status != types.AccountStatusActive {
+		t.Errorf("CloseAccount(): account must not change, account = %+v, target = %+v", account, target)
+	}
+	if err = s.CloseAccountWithCredential(account.ID, target.ID, types.Credential{PIN: "1234"}); err != nil {
+		t.Errorf("CloseAccountWithCredential(): error = %v", err)
+	}
+}
+
+func TestService_Authorize_credential(t *testing.T) {
+	s := newTestService()
+	s.SetAuthThreshold(100_00)
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s.SetPIN(account.ID, "1234", types.Credential{})
+
+	if _, err = s.Authorize(account.ID, 100_01, "food"); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("Authorize(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if account.Held != 0 {
+		t.Errorf("Authorize(): held must not change, held = %v", account.Held)
+	}
+	hold, err := s.AuthorizeWithCredential(account.ID, 200_00, "food", types.Credential{PIN: "1234"})
+	if err != nil {
+		t.Errorf("AuthorizeWithCredential(): error = %v", err)
+		return
+	}
+
+	if _, err = s.Capture(hold.ID, 150_00); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("Capture(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.CaptureWithCredential(hold.ID, 150_00, types.Credential{PIN: "0000"}); !errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("CaptureWithCredential(): must return ErrInvalidCredential, returned = %v", err)
+	}
+	if account.Balance != 9_000_00 || account.Held != 200_00 {
+		t.Errorf("Capture(): account must not change, balance = %v, held = %v", account.Balance, account.Held)
+	}
+	if _, err = s.CaptureWithCredential(hold.ID, 150_00, types.Credential{PIN: "1234"}); err != nil {
+		t.Errorf("CaptureWithCredential(): error = %v", err)
+	}
+	if account.Balance != 8_850_00 || account.Held != 0 {
+		t.Errorf("CaptureWithCredential(): balance = %v, held = %v", account.Balance, account.Held)
+	}
+}
+
+func TestService_PayFromFavorite_credential(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, _ := s.FavoritePayment(payments[0].ID, "school")
+	merchant, _ := s.RegisterMerchant("Coffee House", "food", account.ID)
+	s.SetPIN(account.ID, "1234", types.Credential{})
+	auth := types.Credential{PIN: "1234"}
+
+	if _, err = s.PayFromFavorite(favorite.ID); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("PayFromFavorite(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.PayFromFavoriteAmount(favorite.ID, 10_00); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("PayFromFavoriteAmount(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.Repeat(payments[0].ID); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("Repeat(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.PayMerchant(account.ID, merchant.ID, 10_00); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("PayMerchant(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if _, err = s.ScheduleFavorite(favorite.ID, "@daily", now); !errors.Is(err, ErrCredentialRequired) {
+		t.Errorf("ScheduleFavorite(): must return ErrCredentialRequired, returned = %v", err)
+	}
+	if account.Balance != 9_000_00 {
+		t.Errorf("account must not change, balance = %v", account.Balance)
+	}
+
+	payment, err := s.PayFromFavoriteWithCredential(favorite.ID, auth)
+	if err != nil || payment.FavoriteID != favorite.ID {
+		t.Errorf("PayFromFavoriteWithCredential(): payment = %v, error = %v", payment, err)
+	}
+	if _, err = s.PayFromFavoriteAmountWithCredential(favorite.ID, 10_00, auth); err != nil {
+		t.Errorf("PayFromFavoriteAmountWithCredential(): error = %v", err)
+	}
+	if _, err = s.RepeatWithCredential(payments[0].ID, auth); err != nil {
+		t.Errorf("RepeatWithCredential(): error = %v", err)
+	}
+	if _, err = s.PayMerchantWithCredential(account.ID, merchant.ID, 10_00, auth); err != nil {
+		t.Errorf("PayMerchantWithCredential(): error = %v", err)
+	}
+	if account.Balance != 6_980_00 {
+		t.Errorf("WithCredential(): wrong balance = %v", account.Balance)
+	}
+
+	// runs of authorized schedule need no credential
+	if _, err = s.ScheduleFavoriteWithCredential(favorite.ID, "@daily", now, auth); err != nil {
+		t.Errorf("ScheduleFavoriteWithCredential(): error = %v", err)
+		return
+	}
+	if _, err = s.SchedulePaymentWithCredential(account.ID, 10_00, "food", "@daily", now, auth); err != nil {
+		t.Errorf("SchedulePaymentWithCredential(): error = %v", err)
+		return
+	}
+	runs := s.RunDueSchedules()
+	if len(runs) != 2 || runs[0].Status != types.ScheduleRunOk || runs[1].Status != types.ScheduleRunOk {
+		t.Errorf("RunDueSchedules(): wrong runs = %v", runs)
+	}
+}
@@ -0,0 +1,178 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// recurrence calculates the first run after the given time of schedule
+// which started at start
+type recurrence interface {
+	next(start time.Time, after time.Time) time.Time
+}
+
+// period recurrence of @daily, @weekly and @monthly schedules
+type period struct {
+	months, days int
+}
+
+// next counts months from start, so runs keep the day of start and
+// months shorter than it run on their last day
+func (p period) next(start time.Time, after time.Time) time.Time {
+	if p.months == 0 {
+		return after.AddDate(0, 0, p.days)
+	}
+	months := (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+	if months < 0 {
+		months = 0
+	}
+	months -= months % p.months
+	for {
+		run := addMonths(start, months)
+		if run.After(after) {
+			return run
+		}
+		months += p.months
+	}
+}
+
+// addMonths adds months to t, the day is clamped to the last day of month
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// cron recurrence of "minute hour day-of-month month day-of-week" schedules
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// parseRecurrence parses @daily, @weekly, @monthly or a five field cron expression
+func parseRecurrence(spec string) (recurrence, error) {
+	switch strings.TrimSpace(spec) {
+	case "@daily":
+		return period{days: 1}, nil
+	case "@weekly":
+		return period{days: 7}, nil
+	case "@monthly":
+		return period{months: 1}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q must have 5 fields", ErrInvalidSchedule, spec)
+	}
+
+	c := cron{}
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, spec, err)
+		}
+		*b.field = bits
+	}
+	// both 0 and 7 mean sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField parses comma separated values, ranges and steps like "1,5-10,*/15"
+func parseCronField(field string, min, max int) (uint64, error) {
+	bits := uint64(0)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			value, err := strconv.Atoi(part[i+1:])
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = value
+			part = part[:i]
+		}
+
+		from, to := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.Index(part, "-")
+			low, err := strconv.Atoi(part[:i])
+			if err != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+			high, err := strconv.Atoi(part[i+1:])
+			if err != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+			from, to = low, high
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			from, to = value, value
+		}
+
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := from; value <= to; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (c cron) next(start time.Time, after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case c.month&(1<<uint(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron rules: when both day fields are restricted either one may match
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,109 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// dumpFile is records of one dump file written by Export
+type dumpFile struct {
+	name    string
+	records [][]string
+}
+
+// writeDump writes records to file, one record per line with fields separated by ;
+func writeDump(path string, records [][]string) error {
+	list := ""
+	for _, record := range records {
+		list += strings.Join(record, ";") + "\n"
+	}
+
+	err := ioutil.WriteFile(path, []byte(list), 0666)
+	if err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+// replaceDumps writes every dump to a temporary file of dir and renames them
+// over the dumps after all are written, dumps without records are removed.
+// Other files of dir are kept, export without records needs no dir
+func replaceDumps(dir string, dumps []dumpFile) (err error) {
+	info, err := os.Stat(dir)
+	if !hasRecords(dumps) && (err != nil || !info.IsDir()) {
+		return nil
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	if !info.IsDir() {
+		return ioError(&os.PathError{Op: "export", Path: dir, Err: syscall.ENOTDIR})
+	}
+
+	temps := map[string]string{}
+	defer func() {
+		for _, tmp := range temps {
+			os.Remove(tmp)
+		}
+	}()
+	for _, dump := range dumps {
+		if len(dump.records) == 0 {
+			continue
+		}
+		tmp := filepath.Join(dir, "."+dump.name+".tmp")
+		temps[dump.name] = tmp
+		if err = writeDump(tmp, dump.records); err != nil {
+			return err
+		}
+	}
+
+	for _, dump := range dumps {
+		path := filepath.Join(dir, dump.name)
+		tmp, ok := temps[dump.name]
+		if !ok {
+			if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return ioError(err)
+			}
+			err = nil
+			continue
+		}
+		if err = os.Rename(tmp, path); err != nil {
+			return ioError(err)
+		}
+		delete(temps, dump.name)
+	}
+	return nil
+}
+
+// hasRecords checks that some of dumps has records
+func hasRecords(dumps []dumpFile) bool {
+	for _, dump := range dumps {
+		if len(dump.records) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readDump reads records written by writeDump, missing file has no records
+func readDump(path string) ([][]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	lines = lines[:len(lines)-1]
+
+	records := make([][]string, 0, len(lines))
+	for _, line := range lines {
+		records = append(records, strings.Split(line, ";"))
+	}
+	return records, nil
+}
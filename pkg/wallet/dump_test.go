@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestService_Export_replaces(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "data")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"payments.dump", "payments1.dump", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(parent, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService()
+	s.RegisterAccount("+992938638676")
+	if err := s.Export(link); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "payments.dump")); !os.IsNotExist(err) {
+		t.Errorf("Export(): dump of previous export must be removed, error = %v", err)
+	}
+	for _, name := range []string{"payments1.dump", "notes.txt"} {
+		if content, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != "old\n" {
+			t.Errorf("Export(): %s must be kept, content = %q, error = %v", name, content, err)
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "accounts.dump")); err != nil || string(content) != "1;+992938638676;0;ACTIVE;0\n" {
+		t.Errorf("Export(): accounts.dump = %q, error = %v", content, err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Export(): symlink must be kept, error = %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 4 {
+		t.Errorf("Export(): temporary files must be removed, files = %v", len(files))
+	}
+}
+
+func TestService_Import_invalid(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestService()
+	s.RegisterAccount("+992938638676")
+	s.Deposit(1, 100_00)
+	s.Pay(1, 10_00, "food")
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, "refunds.dump"), []byte("refund;payment;x;100\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported := newTestService()
+	if err := imported.Import(dir); KindOf(err) != KindValidation {
+		t.Errorf("Import(): must return ErrInvalidDump, returned = %v", err)
+	}
+	if len(imported.accounts) != 0 || len(imported.payments) != 0 || imported.nextAccountID != 0 {
+		t.Errorf("Import(): failed import must not change service, accounts = %v, payments = %v", len(imported.accounts), len(imported.payments))
+	}
+}
+
+func TestService_Import_shortRecord(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "phones.dump"), []byte("1;+99\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestService().Import(dir); KindOf(err) != KindValidation {
+		t.Errorf("Import(): must return ErrInvalidDump, returned = %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrIO = errors.New("input/output error")
+var ErrInvalidDump = errors.New("invalid dump record")
+
+// Kind classifies errors, so callers like API layer can map them to responses
+type Kind int
+
+// Error kinds
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindInsufficientFunds
+	KindForbidden
+	KindIO
+	KindCanceled
+)
+
+var kindNames = []string{"unknown", "not found", "validation", "conflict", "insufficient funds", "forbidden", "i/o", "canceled"}
+
+func (k Kind) String() string {
+	if k < KindUnknown || k > KindCanceled {
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// sentinelKinds classifies package errors
+var sentinelKinds = map[error]Kind{
+	ErrAccountNotFound:  KindNotFound,
+	ErrPaymentNotFound:  KindNotFound,
+	ErrFavoriteNotFound: KindNotFound,
+	ErrFileNotFound:     KindNotFound,
+	ErrHoldNotFound:     KindNotFound,
+	ErrScheduleNotFound: KindNotFound,
+	ErrBudgetNotFound:   KindNotFound,
+	ErrMerchantNotFound: KindNotFound,
+	ErrNoPhoneChange:    KindNotFound,
+
+	ErrAmountMustBePositive:  KindValidation,
+	ErrInvalidSchedule:       KindValidation,
+	ErrFavoriteNameRequired:  KindValidation,
+	ErrInvalidFavoriteName:   KindValidation,
+	ErrFavoriteOrderMismatch: KindValidation,
+	ErrInvalidAmountRange:    KindValidation,
+	ErrAmountOutOfRange:      KindValidation,
+	ErrCaptureExceedsHold:    KindValidation,
+	ErrRefundExceedsPayment:  KindValidation,
+	ErrInvalidPhone:          KindValidation,
+	ErrInvalidPIN:            KindValidation,
+	ErrInvalidCode:           KindValidation,
+	ErrVerificationExpired:   KindValidation,
+	ErrSameAccount:           KindValidation,
+	ErrInvalidDump:           KindValidation,
+	ErrLimitExceeded:         KindValidation,
+	ErrInvalidFeeRule:        KindValidation,
+	ErrInvalidOrder:          KindValidation,
+	ErrInvalidQuery:          KindValidation,
+	ErrInvalidCursor:         KindValidation,
+	ErrInvalidReport:         KindValidation,
+	ErrInvalidBudget:         KindValidation,
+	ErrInvalidCategory:       KindValidation,
+	ErrUnknownCategory:       KindValidation,
+	ErrInvalidMerchant:       KindValidation,
+
+	ErrPhoneRegistered:      KindConflict,
+	ErrFavoriteNameTaken:    KindConflict,
+	ErrHoldNotActive:        KindConflict,
+	ErrHoldExpired:          KindConflict,
+	ErrPaymentNotRefundable: KindConflict,
+	ErrAccountNotEmpty:      KindConflict,
+	ErrAccountHasHolds:      KindConflict,
+	ErrPINNotSet:            KindConflict,
+	ErrAuditTampered:        KindConflict,
+	ErrCategoryConflict:     KindConflict,
+	ErrMerchantNameTaken:    KindConflict,
+	ErrNothingToSettle:      KindConflict,
+	ErrNoCodeSender:         KindConflict,
+
+	ErrNotEnoughBalance: KindInsufficientFunds,
+
+	ErrAccountFrozen:      KindForbidden,
+	ErrAccountClosed:      KindForbidden,
+	ErrCredentialRequired: KindForbidden,
+	ErrInvalidCredential:  KindForbidden,
+	ErrCredentialLocked:   KindForbidden,
+	ErrTooManyAttempts:    KindForbidden,
+	ErrBudgetExceeded:     KindForbidden,
+
+	ErrIO: KindIO,
+
+	context.Canceled:         KindCanceled,
+	context.DeadlineExceeded: KindCanceled,
+}
+
+// Error is returned by service operations, Err is one of package errors
+// and Cause is the underlying error if there is one, both are matched by errors.Is
+type Error struct {
+	Kind      Kind
+	Op        string
+	AccountID int64
+	PaymentID string
+	Err       error
+	Cause     error
+}
+
+func (e *Error) Error() string {
+	parts := []string{}
+	if e.Op != "" {
+		parts = append(parts, e.Op)
+	}
+	if e.AccountID != 0 {
+		parts = append(parts, fmt.Sprintf("account %d", e.AccountID))
+	}
+	if e.PaymentID != "" {
+		parts = append(parts, "payment "+e.PaymentID)
+	}
+	message := e.Err.Error()
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+	return strings.Join(append(parts, message), ": ")
+}
+
+// Unwrap returns the underlying cause or the package error
+func (e *Error) Unwrap() error {
+	if e.Cause != nil {
+		return e.Cause
+	}
+	return e.Err
+}
+
+// Is matches the package error when Unwrap returns the cause
+func (e *Error) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Err, target)
+}
+
+// KindOf returns kind of the error returned by service
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindUnknown
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return sentinelKind(err)
+}
+
+func sentinelKind(err error) Kind {
+	for sentinel, kind := range sentinelKinds {
+		if errors.Is(err, sentinel) {
+			return kind
+		}
+	}
+	return KindUnknown
+}
+
+// wrapError converts error returned by operation to *Error, errors of nested
+// operations are reported as errors of op
+//
+//	defer wrapError(&err, "Pay", accountID, "")
+func wrapError(err *error, op string, accountID int64, paymentID string) {
+	if *err == nil {
+		return
+	}
+
+	var inner *Error
+	if errors.As(*err, &inner) {
+		wrapped := *inner
+		wrapped.Op = op
+		if wrapped.AccountID == 0 {
+			wrapped.AccountID = accountID
+		}
+		if wrapped.PaymentID == "" {
+			wrapped.PaymentID = paymentID
+		}
+		*err = &wrapped
+		return
+	}
+
+	*err = &Error{
+		Kind:      sentinelKind(*err),
+		Op:        op,
+		AccountID: accountID,
+		PaymentID: paymentID,
+		Err:       *err,
+	}
+}
+
+// ioError keeps the cause of file system error
+func ioError(cause error) error {
+	if os.IsNotExist(cause) {
+		return &Error{Kind: KindNotFound, Err: ErrFileNotFound, Cause: cause}
+	}
+	return &Error{Kind: KindIO, Err: ErrIO, Cause: cause}
+}
+
+// dumpError reports record of dump file which can not be parsed
+func dumpError(path string, cause error) error {
+	return &Error{Kind: KindValidation, Err: ErrInvalidDump, Cause: fmt.Errorf("%s: %w", path, cause)}
+}
@@ -0,0 +1,110 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestService_Error_fields(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.Pay(account.ID, 20_000_00, "cat")
+	if !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Errorf("Pay(): must return *Error, returned = %T", err)
+		return
+	}
+	if e.Op != "Pay" || e.AccountID != account.ID || e.Kind != KindInsufficientFunds {
+		t.Errorf("Pay(): wrong error = %+v", e)
+	}
+
+	_, err = s.Refund(payments[0].ID, 2_000_00)
+	if KindOf(err) != KindValidation {
+		t.Errorf("Refund(): wrong kind = %v", KindOf(err))
+	}
+	if !errors.As(err, &e) || e.PaymentID != payments[0].ID {
+		t.Errorf("Refund(): wrong error = %v", err)
+	}
+}
+
+func TestService_Error_nested(t *testing.T) {
+	s := newTestService()
+
+	_, err := s.Repeat("unknown")
+	if !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Repeat(): must return ErrPaymentNotFound, returned = %v", err)
+	}
+	if KindOf(err) != KindNotFound {
+		t.Errorf("Repeat(): wrong kind = %v", KindOf(err))
+	}
+	if err.Error() != "Repeat: payment unknown: payment not found" {
+		t.Errorf("Repeat(): wrong message = %v", err)
+	}
+}
+
+func TestService_Import_cause(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "accounts.dump"), []byte("x;+992000000001;100;ACTIVE\n"), 0666)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	s := newTestService()
+	err = s.Import(dir)
+	if !errors.Is(err, ErrInvalidDump) {
+		t.Errorf("Import(): must return ErrInvalidDump, returned = %v", err)
+	}
+	if KindOf(err) != KindValidation {
+		t.Errorf("Import(): wrong kind = %v", KindOf(err))
+	}
+
+	err = s.ImportFromFile(filepath.Join(dir, "missing.txt"))
+	if !errors.Is(err, ErrFileNotFound) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ImportFromFile(): must return ErrFileNotFound, returned = %v", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("ImportFromFile(): must keep *os.PathError, returned = %v", err)
+	}
+
+	// s has audit record of the failed import, so only new service is empty
+	err = newTestService().Export(filepath.Join(dir, "accounts.dump"))
+	if err != nil {
+		t.Errorf("Export(): error = %v", err)
+	}
+	s.RegisterAccount("+992000000002")
+	err = s.Export(filepath.Join(dir, "accounts.dump"))
+	if KindOf(err) != KindIO || !errors.Is(err, ErrIO) {
+		t.Errorf("Export(): must return ErrIO, returned = %v", err)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	if KindOf(nil) != KindUnknown {
+		t.Errorf("KindOf(): wrong kind = %v", KindOf(nil))
+	}
+	if KindOf(ErrAccountFrozen) != KindForbidden {
+		t.Errorf("KindOf(): wrong kind = %v", KindOf(ErrAccountFrozen))
+	}
+	if KindOf(ErrNoCodeSender) != KindConflict {
+		t.Errorf("KindOf(): wrong kind = %v", KindOf(ErrNoCodeSender))
+	}
+	if KindOf(errors.New("other")) != KindUnknown {
+		t.Errorf("KindOf(): wrong kind = %v", KindOf(errors.New("other")))
+	}
+	if KindNotFound.String() != "not found" {
+		t.Errorf("String(): wrong name = %v", KindNotFound)
+	}
+}
@@ -0,0 +1,263 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrFavoriteNameRequired = errors.New("favorite name is required")
+var ErrInvalidFavoriteName = errors.New("favorite name must not have ; or line break")
+var ErrFavoriteNameTaken = errors.New("favorite name already used by account")
+var ErrFavoriteOrderMismatch = errors.New("favorites order must contain every favorite of account once")
+var ErrInvalidAmountRange = errors.New("invalid amount range")
+var ErrAmountOutOfRange = errors.New("amount is out of favorite range")
+
+// FavoritesByAccount returns favorites of the account in their order
+func (s *Service) FavoritesByAccount(accountID int64) (favorites []types.Favorite, err error) {
+	defer wrapError(&err, "FavoritesByAccount", accountID, "")
+
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	favorites = []types.Favorite{}
+	for _, favorite := range s.favorites {
+		if favorite.AccountID == accountID {
+			favorites = append(favorites, *favorite)
+		}
+	}
+	return favorites, nil
+}
+
+// RenameFavorite changes the name of favorite, names are unique per account
+func (s *Service) RenameFavorite(favoriteID string, name string) (err error) {
+	defer wrapError(&err, "RenameFavorite", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("RenameFavorite", s.accountOfFavorite(favoriteID), 0, favoriteID, name).finish(&err)
+
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkFavoriteName(favorite.AccountID, favorite.ID, name)
+	if err != nil {
+		return err
+	}
+
+	favorite.Name = name
+	return nil
+}
+
+// UpdateFavorite changes amount and category of favorite, amount must be in favorite
+// range and category is resolved by the registry
+func (s *Service) UpdateFavorite(favoriteID string, amount types.Money, category types.PaymentCategory) (err error) {
+	defer wrapError(&err, "UpdateFavorite", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("UpdateFavorite", s.accountOfFavorite(favoriteID), 0, favoriteID, amount, category).finish(&err)
+
+	if amount <= 0 {
+		return ErrAmountMustBePositive
+	}
+
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return err
+	}
+	if !favoriteAllows(favorite, amount) {
+		return ErrAmountOutOfRange
+	}
+	if category, err = s.resolveCategory(category); err != nil {
+		return err
+	}
+
+	favorite.Amount = amount
+	favorite.Category = category
+	return nil
+}
+
+// ReorderFavorites puts favorites of the account in the order of favoriteIDs
+func (s *Service) ReorderFavorites(accountID int64, favoriteIDs []string) (err error) {
+	defer wrapError(&err, "ReorderFavorites", accountID, "")
+	defer s.startAudit("ReorderFavorites", accountID, 0, strings.Join(favoriteIDs, " ")).finish(&err)
+
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return err
+	}
+
+	positions := []int{}
+	byID := map[string]*types.Favorite{}
+	for i, favorite := range s.favorites {
+		if favorite.AccountID == accountID {
+			positions = append(positions, i)
+			byID[favorite.ID] = favorite
+		}
+	}
+	if len(favoriteIDs) != len(positions) {
+		return ErrFavoriteOrderMismatch
+	}
+
+	ordered := make([]*types.Favorite, 0, len(favoriteIDs))
+	for _, id := range favoriteIDs {
+		favorite, ok := byID[id]
+		if !ok {
+			return ErrFavoriteOrderMismatch
+		}
+		delete(byID, id)
+		ordered = append(ordered, favorite)
+	}
+
+	for i, position := range positions {
+		s.favorites[position] = ordered[i]
+	}
+	return nil
+}
+
+// DeleteFavorite removes favorite and cancels its schedules
+func (s *Service) DeleteFavorite(favoriteID string) (err error) {
+	defer wrapError(&err, "DeleteFavorite", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("DeleteFavorite", s.accountOfFavorite(favoriteID), 0, favoriteID).finish(&err)
+
+	for i, favorite := range s.favorites {
+		if favorite.ID != favoriteID {
+			continue
+		}
+
+		s.favorites = append(s.favorites[:i], s.favorites[i+1:]...)
+		for _, schedule := range s.schedules {
+			if schedule.FavoriteID == favoriteID {
+				schedule.Active = false
+			}
+		}
+		return nil
+	}
+	return ErrFavoriteNotFound
+}
+
+// checkFavoriteName checks that name is not empty, has no separators of dumps
+// and is not used by other favorites of account
+func (s *Service) checkFavoriteName(accountID int64, favoriteID string, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrFavoriteNameRequired
+	}
+	if strings.ContainsAny(name, ";\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidFavoriteName, name)
+	}
+	for _, favorite := range s.favorites {
+		if favorite.AccountID == accountID && favorite.ID != favoriteID && strings.EqualFold(favorite.Name, name) {
+			return ErrFavoriteNameTaken
+		}
+	}
+	return nil
+}
+
+// SetFavoriteRange sets the range of amounts which can be paid from favorite,
+// zero min or max means no limit. Favorite amount must be in the range
+func (s *Service) SetFavoriteRange(favoriteID string, min types.Money, max types.Money) (err error) {
+	defer wrapError(&err, "SetFavoriteRange", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("SetFavoriteRange", s.accountOfFavorite(favoriteID), 0, favoriteID, min, max).finish(&err)
+
+	if min < 0 || max < 0 || (max != 0 && min > max) {
+		return ErrInvalidAmountRange
+	}
+
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return err
+	}
+	if !favoriteAllows(&types.Favorite{MinAmount: min, MaxAmount: max}, favorite.Amount) {
+		return fmt.Errorf("%w: favorite amount %d", ErrAmountOutOfRange, favorite.Amount)
+	}
+
+	favorite.MinAmount = min
+	favorite.MaxAmount = max
+	return nil
+}
+
+// FavoriteUsage returns count and total of payments made from favorite
+func (s *Service) FavoriteUsage(favoriteID string) (usage types.FavoriteUsage, err error) {
+	defer wrapError(&err, "FavoriteUsage", s.accountOfFavorite(favoriteID), "")
+
+	usage = types.FavoriteUsage{FavoriteID: favoriteID}
+	if _, err := s.FindFavoriteByID(favoriteID); err != nil {
+		return usage, err
+	}
+
+	for _, payment := range s.payments {
+		if payment.FavoriteID == favoriteID && payment.Status != types.PaymentStatusFail {
+			usage.Count++
+			usage.Total += payment.Amount
+		}
+	}
+	return usage, nil
+}
+
+// favoriteAllows checks that amount is in favorite range
+func favoriteAllows(favorite *types.Favorite, amount types.Money) bool {
+	if favorite.MinAmount != 0 && amount < favorite.MinAmount {
+		return false
+	}
+	if favorite.MaxAmount != 0 && amount > favorite.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// favoriteRecords converts favorites to dump records
+func (s *Service) favoriteRecords() [][]string {
+	records := make([][]string, 0, len(s.favorites))
+	for _, favorite := range s.favorites {
+		records = append(records, []string{
+			fmt.Sprint(favorite.ID),
+			fmt.Sprint(favorite.AccountID),
+			fmt.Sprint(favorite.Name),
+			fmt.Sprint(favorite.Amount),
+			fmt.Sprint(favorite.Category),
+			fmt.Sprint(favorite.MinAmount),
+			fmt.Sprint(favorite.MaxAmount),
+		})
+	}
+	return records
+}
+
+// importFavorites restores favorites from dump records, older dumps have no range
+func (s *Service) importFavorites(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("favorite record has %d fields", len(record))
+		}
+		accountID, err := strconv.Atoi(record[1])
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.Atoi(record[3])
+		if err != nil {
+			return err
+		}
+		favorite := &types.Favorite{
+			ID:        record[0],
+			AccountID: int64(accountID),
+			Name:      record[2],
+			Amount:    types.Money(amount),
+			Category:  types.PaymentCategory(record[4]),
+		}
+		if len(record) > 6 {
+			minAmount, err := strconv.Atoi(record[5])
+			if err != nil {
+				return err
+			}
+			maxAmount, err := strconv.Atoi(record[6])
+			if err != nil {
+				return err
+			}
+			favorite.MinAmount = types.Money(minAmount)
+			favorite.MaxAmount = types.Money(maxAmount)
+		}
+
+		s.favorites = append(s.favorites, favorite)
+		s.log().Debug("favorite imported", "account_id", favorite.AccountID, "favorite_id", favorite.ID)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_FavoritePayment_nameTaken(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.FavoritePayment(payments[0].ID, "school")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	_, err = s.FavoritePayment(payments[0].ID, "School")
+	if !errors.Is(err, ErrFavoriteNameTaken) {
+		t.Errorf("FavoritePayment(): must return ErrFavoriteNameTaken, returned = %v", err)
+	}
+}
+
+func TestService_RenameFavorite_success(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	first, err := s.FavoritePayment(payments[0].ID, "school")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+	second, err := s.FavoritePayment(payments[0].ID, "gym")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	err = s.RenameFavorite(second.ID, "school")
+	if !errors.Is(err, ErrFavoriteNameTaken) {
+		t.Errorf("RenameFavorite(): must return ErrFavoriteNameTaken, returned = %v", err)
+	}
+
+	err = s.RenameFavorite(first.ID, "university")
+	if err != nil {
+		t.Errorf("RenameFavorite(): error = %v", err)
+		return
+	}
+	if first.Name != "university" {
+		t.Errorf("RenameFavorite(): wrong name = %v", first.Name)
+	}
+}
+
+func TestService_RenameFavorite_separators(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "school, \"main\" | tab\there")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	for _, name := range []string{"school;gym", "school\ngym", "school\r\ngym"} {
+		if _, err = s.FavoritePayment(payments[0].ID, name); !errors.Is(err, ErrInvalidFavoriteName) || KindOf(err) != KindValidation {
+			t.Errorf("FavoritePayment(%q): must return ErrInvalidFavoriteName, returned = %v", name, err)
+		}
+		if err = s.RenameFavorite(favorite.ID, name); !errors.Is(err, ErrInvalidFavoriteName) {
+			t.Errorf("RenameFavorite(%q): must return ErrInvalidFavoriteName, returned = %v", name, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err = s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err = imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	want, _ := s.FavoritesByAccount(account.ID)
+	got, err := imported.FavoritesByAccount(account.ID)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Import(): favorites = %v, want %v, error = %v", got, want, err)
+	}
+}
+
+func TestService_ReorderFavorites_exportImport(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ids := []string{}
+	for _, name := range []string{"school", "gym", "internet"} {
+		favorite, err := s.FavoritePayment(payments[0].ID, name)
+		if err != nil {
+			t.Errorf("FavoritePayment(): error = %v", err)
+			return
+		}
+		ids = append(ids, favorite.ID)
+	}
+
+	err = s.ReorderFavorites(account.ID, []string{ids[2], ids[0]})
+	if !errors.Is(err, ErrFavoriteOrderMismatch) {
+		t.Errorf("ReorderFavorites(): must return ErrFavoriteOrderMismatch, returned = %v", err)
+	}
+
+	err = s.ReorderFavorites(account.ID, []string{ids[2], ids[0], ids[1]})
+	if err != nil {
+		t.Errorf("ReorderFavorites(): error = %v", err)
+		return
+	}
+	err = s.UpdateFavorite(ids[0], 50_00, "education")
+	if err != nil {
+		t.Errorf("UpdateFavorite(): error = %v", err)
+		return
+	}
+	err = s.DeleteFavorite(ids[1])
+	if err != nil {
+		t.Errorf("DeleteFavorite(): error = %v", err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = s.Export(dir)
+	if err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	svc := &Service{}
+	err = svc.Import(dir)
+	if err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+
+	favorites, err := svc.FavoritesByAccount(account.ID)
+	if err != nil {
+		t.Errorf("FavoritesByAccount(): error = %v", err)
+		return
+	}
+	want := []types.Favorite{
+		{ID: ids[2], AccountID: account.ID, Name: "internet", Amount: 1_000_00, Category: "cat"},
+		{ID: ids[0], AccountID: account.ID, Name: "school", Amount: 50_00, Category: "education"},
+	}
+	if !reflect.DeepEqual(want, favorites) {
+		t.Errorf("FavoritesByAccount(): want = %v, got = %v", want, favorites)
+	}
+}
+
+func TestService_PayFromFavorite_amountOverride(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "electricity")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+	err = s.SetFavoriteRange(favorite.ID, 500_00, 1_500_00)
+	if err != nil {
+		t.Errorf("SetFavoriteRange(): error = %v", err)
+		return
+	}
+
+	payment, err := s.PayFromFavoriteAmount(favorite.ID, 1_200_00)
+	if err != nil {
+		t.Errorf("PayFromFavoriteAmount(): error = %v", err)
+		return
+	}
+	if payment.Amount != 1_200_00 || payment.FavoriteID != favorite.ID {
+		t.Errorf("PayFromFavoriteAmount(): wrong payment = %v", payment)
+	}
+	if account.Balance != 7_800_00 {
+		t.Errorf("PayFromFavoriteAmount(): wrong balance = %v", account.Balance)
+	}
+
+	_, err = s.PayFromFavoriteAmount(favorite.ID, 2_000_00)
+	if !errors.Is(err, ErrAmountOutOfRange) {
+		t.Errorf("PayFromFavoriteAmount(): must return ErrAmountOutOfRange, returned = %v", err)
+	}
+
+	_, err = s.PayFromFavorite(favorite.ID)
+	if err != nil {
+		t.Errorf("PayFromFavorite(): error = %v", err)
+		return
+	}
+
+	usage, err := s.FavoriteUsage(favorite.ID)
+	if err != nil {
+		t.Errorf("FavoriteUsage(): error = %v", err)
+		return
+	}
+	want := types.FavoriteUsage{FavoriteID: favorite.ID, Count: 2, Total: 2_200_00}
+	if usage != want {
+		t.Errorf("FavoriteUsage(): want = %v, got = %v", want, usage)
+	}
+}
+
+func TestService_SetFavoriteRange_favoriteAmount(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "electricity")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	err = s.SetFavoriteRange(favorite.ID, 1_500_00, 2_000_00)
+	if !errors.Is(err, ErrAmountOutOfRange) {
+		t.Errorf("SetFavoriteRange(): must return ErrAmountOutOfRange, returned = %v", err)
+	}
+	err = s.SetFavoriteRange(favorite.ID, 0, 500_00)
+	if !errors.Is(err, ErrAmountOutOfRange) {
+		t.Errorf("SetFavoriteRange(): must return ErrAmountOutOfRange, returned = %v", err)
+	}
+	if favorite.MinAmount != 0 || favorite.MaxAmount != 0 {
+		t.Errorf("SetFavoriteRange(): range must not change, favorite = %v", favorite)
+	}
+
+	if err = s.SetFavoriteRange(favorite.ID, 500_00, 1_500_00); err != nil {
+		t.Errorf("SetFavoriteRange(): error = %v", err)
+		return
+	}
+	err = s.UpdateFavorite(favorite.ID, 2_000_00, favorite.Category)
+	if !errors.Is(err, ErrAmountOutOfRange) || favorite.Amount != 1_000_00 {
+		t.Errorf("UpdateFavorite(): must return ErrAmountOutOfRange, amount = %v, returned = %v", favorite.Amount, err)
+	}
+}
+
+func TestService_PayFromFavorite_indexedForNotifier(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "electricity")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+	found := -1
+	s.SetBudgetNotifier(BudgetNotifierFunc(func(alert types.BudgetAlert) {
+		page, err := s.QueryPayments(PaymentQuery{FavoriteIDs: []string{favorite.ID}})
+		if err == nil {
+			found = len(page.Payments)
+		}
+	}))
+	s.SetBudget(types.Budget{AccountID: account.ID, Category: "cat", Amount: 1_500_00})
+
+	if _, err = s.PayFromFavorite(favorite.ID); err != nil {
+		t.Errorf("PayFromFavorite(): error = %v", err)
+		return
+	}
+	if found != 1 {
+		t.Errorf("PayFromFavorite(): notifier must find the payment, found = %v", found)
+	}
+}
@@ -0,0 +1,78 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrLimitExceeded = errors.New("amount exceeds limit")
+var ErrInvalidFeeRule = errors.New("invalid fee rule")
+
+// basisPointsPerUnit is how many basis points make the whole amount
+const basisPointsPerUnit = 10_000
+
+// SetLimits sets the largest amounts of a payment and a deposit, zero means no limit
+func (s *Service) SetLimits(maxPayment types.Money, maxDeposit types.Money) {
+	s.maxPayment = maxPayment
+	s.maxDeposit = maxDeposit
+}
+
+// SetFeeRules sets fees of payments, there may be one rule per category
+func (s *Service) SetFeeRules(rules []types.FeeRule) (err error) {
+	defer wrapError(&err, "SetFeeRules", 0, "")
+
+	if err = ValidateFeeRules(rules); err != nil {
+		return err
+	}
+	s.feeRules = append([]types.FeeRule(nil), rules...)
+	return nil
+}
+
+// ValidateFeeRules checks that amounts are not negative, Min is not above Max
+// and categories are not repeated
+func ValidateFeeRules(rules []types.FeeRule) error {
+	seen := map[types.PaymentCategory]bool{}
+	for _, rule := range rules {
+		switch {
+		case rule.Fixed < 0 || rule.BasisPoints < 0 || rule.Min < 0 || rule.Max < 0:
+			return fmt.Errorf("%w: category %q: amounts must not be negative", ErrInvalidFeeRule, rule.Category)
+		case rule.BasisPoints > basisPointsPerUnit:
+			return fmt.Errorf("%w: category %q: basis points must not exceed %d", ErrInvalidFeeRule, rule.Category, basisPointsPerUnit)
+		case rule.Max != 0 && rule.Min > rule.Max:
+			return fmt.Errorf("%w: category %q: min is above max", ErrInvalidFeeRule, rule.Category)
+		case seen[rule.Category]:
+			return fmt.Errorf("%w: category %q: repeated rule", ErrInvalidFeeRule, rule.Category)
+		}
+		seen[rule.Category] = true
+	}
+	return nil
+}
+
+// fee returns fee of payment by the rule of its category or the default rule
+func (s *Service) fee(amount types.Money, category types.PaymentCategory) types.Money {
+	var rule *types.FeeRule
+	for i := range s.feeRules {
+		switch s.feeRules[i].Category {
+		case category:
+			rule = &s.feeRules[i]
+		case "":
+			if rule == nil {
+				rule = &s.feeRules[i]
+			}
+		}
+	}
+	if rule == nil {
+		return 0
+	}
+
+	fee := rule.Fixed + amount*types.Money(rule.BasisPoints)/basisPointsPerUnit
+	if fee < rule.Min {
+		fee = rule.Min
+	}
+	if rule.Max != 0 && fee > rule.Max {
+		fee = rule.Max
+	}
+	return fee
+}
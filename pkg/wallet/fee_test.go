@@ -0,0 +1,113 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_SetFeeRules_pay(t *testing.T) {
+	s := newTestService()
+	err := s.SetFeeRules([]types.FeeRule{
+		{Category: "", BasisPoints: 100, Min: 5_00},
+		{Category: "food", Fixed: 1_00, Max: 2_00},
+	})
+	if err != nil {
+		t.Errorf("SetFeeRules(): error = %v", err)
+		return
+	}
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// default rule: 1% of 1_000_00 is 10_00
+	if account.Balance != 8_990_00 {
+		t.Errorf("Pay(): wrong balance = %v", account.Balance)
+	}
+
+	payment, err := s.Pay(account.ID, 100_00, "food")
+	if err != nil {
+		t.Errorf("Pay(): error = %v", err)
+		return
+	}
+	if payment.Fee != 1_00 || account.Balance != 8_889_00 {
+		t.Errorf("Pay(): fee = %v, balance = %v", payment.Fee, account.Balance)
+	}
+
+	err = s.Reject(payment.ID)
+	if err != nil {
+		t.Errorf("Reject(): error = %v", err)
+	}
+	if account.Balance != 8_990_00 {
+		t.Errorf("Reject(): fee must be returned, balance = %v", account.Balance)
+	}
+
+	_, err = s.Pay(account.ID, 8_990_00, "cat")
+	if !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if imported.payments[0].Fee != 10_00 {
+		t.Errorf("Import(): wrong fee = %v", imported.payments[0].Fee)
+	}
+}
+
+func TestService_SetFeeRules_capture(t *testing.T) {
+	s := newTestService()
+	s.SetFeeRules([]types.FeeRule{{Category: "food", Fixed: 1_00}})
+	account, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s.Deposit(account.ID, 100_00)
+
+	if _, err = s.Authorize(account.ID, 100_00, "food"); !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Authorize(): fee must be affordable, returned = %v", err)
+	}
+	hold, err := s.Authorize(account.ID, 50_00, "food")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+	payment, err := s.Capture(hold.ID, 40_00)
+	if err != nil || payment.Fee != 1_00 || account.Balance != 59_00 || account.Held != 0 {
+		t.Errorf("Capture(): payment = %v, balance = %v, held = %v, error = %v", payment, account.Balance, account.Held, err)
+	}
+}
+
+func TestService_SetLimits(t *testing.T) {
+	s := newTestService()
+	s.SetLimits(1_000_00, 10_000_00)
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.Pay(account.ID, 1_000_01, "cat")
+	if !errors.Is(err, ErrLimitExceeded) || KindOf(err) != KindValidation {
+		t.Errorf("Pay(): must return ErrLimitExceeded, returned = %v", err)
+	}
+	err = s.Deposit(account.ID, 10_000_01)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Deposit(): must return ErrLimitExceeded, returned = %v", err)
+	}
+
+	err = s.SetFeeRules([]types.FeeRule{{Min: 2_00, Max: 1_00}})
+	if !errors.Is(err, ErrInvalidFeeRule) {
+		t.Errorf("SetFeeRules(): must return ErrInvalidFeeRule, returned = %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrHoldNotFound = errors.New("hold not found")
+var ErrHoldNotActive = errors.New("hold is not active")
+var ErrHoldExpired = errors.New("hold expired")
+var ErrCaptureExceedsHold = errors.New("capture amount exceeds hold")
+
+// defaultHoldTTL is used when SetHoldTTL was not called
+const defaultHoldTTL = 7 * 24 * time.Hour
+
+// SetHoldTTL sets the time after which active holds expire
+func (s *Service) SetHoldTTL(ttl time.Duration) {
+	s.holdTTL = ttl
+}
+
+// Authorize reserves amount on the account without paying it, accounts with
+// credential must use AuthorizeWithCredential for amounts above the auth threshold
+func (s *Service) Authorize(accountID int64, amount types.Money, category types.PaymentCategory) (*types.Hold, error) {
+	return s.authorize(accountID, amount, category, nil)
+}
+
+// AuthorizeWithCredential reserves amount confirmed by credential
+func (s *Service) AuthorizeWithCredential(accountID int64, amount types.Money, category types.PaymentCategory, auth types.Credential) (*types.Hold, error) {
+	return s.authorize(accountID, amount, category, &auth)
+}
+
+// authorize checks credential if it is given or required and makes hold
+func (s *Service) authorize(accountID int64, amount types.Money, category types.PaymentCategory, auth *types.Credential) (hold *types.Hold, err error) {
+	defer wrapError(&err, "Authorize", accountID, "")
+	defer s.startAudit("Authorize", accountID, 0, amount, category).finish(&err)
+
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	category, err = s.resolveCategory(category)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAccountStatus(account)
+	if err != nil {
+		return nil, err
+	}
+	err = s.authorizeOperation(accountID, auth, amount > s.authThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	s.expireHolds()
+	if account.Available() < amount+s.fee(amount, category) {
+		return nil, ErrNotEnoughBalance
+	}
+	if _, err = s.checkBudget(accountID, category, s.heldAmount(accountID, category)+amount); err != nil {
+		return nil, err
+	}
+
+	ttl := s.holdTTL
+	if ttl <= 0 {
+		ttl = defaultHoldTTL
+	}
+	now := s.currentTime()
+
+	hold = &types.Hold{
+		ID:        uuid.New().String(),
+		AccountID: accountID,
+		Amount:    amount,
+		Category:  category,
+		Status:    types.HoldStatusActive,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	account.Held += amount
+	s.holds = append(s.holds, hold)
+	return hold, nil
+}
+
+// FindHoldByID find hold by id
+func (s *Service) FindHoldByID(holdID string) (hold *types.Hold, err error) {
+	defer wrapError(&err, "FindHoldByID", 0, "")
+
+	s.expireHolds()
+	for _, hold := range s.holds {
+		if hold.ID == holdID {
+			return hold, nil
+		}
+	}
+	return nil, ErrHoldNotFound
+}
+
+// Capture pays amount (not more than authorized) from the hold and releases
+// the rest, fee is charged like for payments. Accounts with credential must use CaptureWithCredential for
+// amounts above the auth threshold
+func (s *Service) Capture(holdID string, amount types.Money) (*types.Payment, error) {
+	return s.capture(holdID, amount, nil)
+}
+
+// CaptureWithCredential captures hold confirmed by credential
+func (s *Service) CaptureWithCredential(holdID string, amount types.Money, auth types.Credential) (*types.Payment, error) {
+	return s.capture(holdID, amount, &auth)
+}
+
+// capture checks credential if it is given or required and pays from hold
+func (s *Service) capture(holdID string, amount types.Money, auth *types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "Capture", s.accountOfHold(holdID), "")
+	defer s.startAudit("Capture", s.accountOfHold(holdID), 0, holdID, amount).finish(&err)
+
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	hold, err := s.activeHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+	if amount > hold.Amount {
+		return nil, ErrCaptureExceedsHold
+	}
+
+	account, err := s.FindAccountByID(hold.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAccountStatus(account)
+	if err != nil {
+		return nil, err
+	}
+	err = s.authorizeOperation(hold.AccountID, auth, amount > s.authThreshold)
+	if err != nil {
+		return nil, err
+	}
+	// other holds of category stay reserved, this one is replaced by the payment
+	held := s.heldAmount(hold.AccountID, hold.Category) - hold.Amount
+	spent, err := s.checkBudget(hold.AccountID, hold.Category, held+amount)
+	if err != nil {
+		return nil, err
+	}
+	fee := s.fee(amount, hold.Category)
+	if account.Available()+hold.Amount < amount+fee {
+		return nil, ErrNotEnoughBalance
+	}
+
+	account.Held -= hold.Amount
+	account.Balance -= amount + fee
+	hold.Status = types.HoldStatusCaptured
+
+	payment = &types.Payment{
+		ID:        uuid.New().String(),
+		AccountID: hold.AccountID,
+		Amount:    amount,
+		Category:  hold.Category,
+		Status:    types.PaymentStatusInProgress,
+		Fee:       fee,
+		CreatedAt: s.currentTime(),
+	}
+	s.payments = append(s.payments, payment)
+	s.alertBudget(payment, spent)
+	return payment, nil
+}
+
+// Void releases the hold without paying
+func (s *Service) Void(holdID string) (err error) {
+	defer wrapError(&err, "Void", s.accountOfHold(holdID), "")
+	defer s.startAudit("Void", s.accountOfHold(holdID), 0, holdID).finish(&err)
+
+	hold, err := s.activeHold(holdID)
+	if err != nil {
+		return err
+	}
+
+	account, err := s.FindAccountByID(hold.AccountID)
+	if err != nil {
+		return err
+	}
+
+	account.Held -= hold.Amount
+	hold.Status = types.HoldStatusVoided
+	return nil
+}
+
+// ExpireHolds releases all active holds which are expired and returns their count
+func (s *Service) ExpireHolds() int {
+	return s.expireHolds()
+}
+
+// heldAmount sums active holds of account in category, they are counted
+// against the budget before they are captured
+func (s *Service) heldAmount(accountID int64, category types.PaymentCategory) types.Money {
+	held := types.Money(0)
+	for _, hold := range s.holds {
+		if hold.AccountID == accountID && hold.Category == category && hold.Status == types.HoldStatusActive {
+			held += hold.Amount
+		}
+	}
+	return held
+}
+
+// activeHold returns the hold if it can still be captured or voided
+func (s *Service) activeHold(holdID string) (*types.Hold, error) {
+	hold, err := s.FindHoldByID(holdID)
+	if err != nil {
+		return nil, err
+	}
+	switch hold.Status {
+	case types.HoldStatusActive:
+		return hold, nil
+	case types.HoldStatusExpired:
+		return nil, ErrHoldExpired
+	default:
+		return nil, ErrHoldNotActive
+	}
+}
+
+func (s *Service) expireHolds() int {
+	now := s.currentTime()
+	expired := 0
+	for _, hold := range s.holds {
+		if hold.Status != types.HoldStatusActive || now.Before(hold.ExpiresAt) {
+			continue
+		}
+		audit := s.startAudit("ExpireHold", hold.AccountID, 0, hold.ID)
+		hold.Status = types.HoldStatusExpired
+		if account, err := s.FindAccountByID(hold.AccountID); err == nil {
+			account.Held -= hold.Amount
+		}
+		audit.finish(nil)
+		expired++
+	}
+	return expired
+}
+
+// holdRecords converts holds to dump records, times are unix seconds
+func (s *Service) holdRecords() [][]string {
+	records := make([][]string, 0, len(s.holds))
+	for _, hold := range s.holds {
+		records = append(records, []string{
+			hold.ID,
+			strconv.FormatInt(hold.AccountID, 10),
+			strconv.FormatInt(int64(hold.Amount), 10),
+			string(hold.Category),
+			string(hold.Status),
+			strconv.FormatInt(hold.CreatedAt.Unix(), 10),
+			strconv.FormatInt(hold.ExpiresAt.Unix(), 10),
+		})
+	}
+	return records
+}
+
+// importHolds restores holds from dump records, active holds are added to
+// held amount of their accounts which is not in accounts dump
+func (s *Service) importHolds(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 7 {
+			return fmt.Errorf("hold record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		createdAt, err := strconv.ParseInt(record[5], 10, 64)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := strconv.ParseInt(record[6], 10, 64)
+		if err != nil {
+			return err
+		}
+		hold := &types.Hold{
+			ID:        record[0],
+			AccountID: accountID,
+			Amount:    types.Money(amount),
+			Category:  types.PaymentCategory(record[3]),
+			Status:    types.HoldStatus(record[4]),
+			CreatedAt: time.Unix(createdAt, 0),
+			ExpiresAt: time.Unix(expiresAt, 0),
+		}
+		if hold.Status == types.HoldStatusActive {
+			for _, account := range s.accounts {
+				if account.ID == hold.AccountID {
+					account.Held += hold.Amount
+				}
+			}
+		}
+		s.holds = append(s.holds, hold)
+	}
+	return nil
+}
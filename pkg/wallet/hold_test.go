@@ -0,0 +1,176 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestService_Capture_success(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := s.Authorize(account.ID, 5_000_00, "hotel")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+	if account.Balance != 9_000_00 || account.Available() != 4_000_00 {
+		t.Errorf("Authorize(): balance = %v, available = %v", account.Balance, account.Available())
+		return
+	}
+
+	payment, err := s.Capture(hold.ID, 3_000_00)
+	if err != nil {
+		t.Errorf("Capture(): error = %v", err)
+		return
+	}
+	if payment.Amount != 3_000_00 {
+		t.Errorf("Capture(): wrong amount = %v", payment.Amount)
+	}
+	if account.Balance != 6_000_00 || account.Available() != 6_000_00 {
+		t.Errorf("Capture(): balance = %v, available = %v", account.Balance, account.Available())
+	}
+
+	_, err = s.Capture(hold.ID, 1_00)
+	if !errors.Is(err, ErrHoldNotActive) {
+		t.Errorf("Capture(): must return ErrHoldNotActive, returned = %v", err)
+	}
+}
+
+func TestService_Authorize_notEnoughBalance(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = s.Authorize(account.ID, 8_000_00, "fuel")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+
+	_, err = s.Pay(account.ID, 2_000_00, "food")
+	if !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+}
+
+func TestService_Capture_exceedsHold(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := s.Authorize(account.ID, 1_000_00, "fuel")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+
+	_, err = s.Capture(hold.ID, 1_000_01)
+	if !errors.Is(err, ErrCaptureExceedsHold) {
+		t.Errorf("Capture(): must return ErrCaptureExceedsHold, returned = %v", err)
+	}
+}
+
+func TestService_Void_success(t *testing.T) {
+	s := newTestService()
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := s.Authorize(account.ID, 1_000_00, "fuel")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+
+	err = s.Void(hold.ID)
+	if err != nil {
+		t.Errorf("Void(): error = %v", err)
+		return
+	}
+	if account.Available() != account.Balance {
+		t.Errorf("Void(): available = %v, balance = %v", account.Available(), account.Balance)
+	}
+}
+
+func TestService_Hold_expired(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	s.SetHoldTTL(time.Hour)
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := s.Authorize(account.ID, 1_000_00, "hotel")
+	if err != nil {
+		t.Errorf("Authorize(): error = %v", err)
+		return
+	}
+
+	now = now.Add(time.Hour)
+
+	_, err = s.Capture(hold.ID, 1_000_00)
+	if !errors.Is(err, ErrHoldExpired) {
+		t.Errorf("Capture(): must return ErrHoldExpired, returned = %v", err)
+	}
+	if account.Held != 0 {
+		t.Errorf("Capture(): expired hold is not released, held = %v", account.Held)
+	}
+}
+
+func TestService_Export_holds(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	active, _ := s.Authorize(account.ID, 1_000_00, "hotel")
+	voided, _ := s.Authorize(account.ID, 500_00, "fuel")
+	s.Void(voided.ID)
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	imported.SetClock(func() time.Time { return now })
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	importedAccount, _ := imported.FindAccountByID(account.ID)
+	if importedAccount.Held != 1_000_00 || importedAccount.Available() != account.Available() {
+		t.Errorf("Import(): held = %v, available = %v", importedAccount.Held, importedAccount.Available())
+	}
+	hold, err := imported.FindHoldByID(active.ID)
+	if err != nil || !hold.ExpiresAt.Equal(active.ExpiresAt) || hold.Category != "hotel" {
+		t.Errorf("Import(): hold = %+v, error = %v", hold, err)
+	}
+	if _, err := imported.Capture(active.ID, 1_000_00); err != nil || importedAccount.Held != 0 {
+		t.Errorf("Capture(): held = %v, error = %v", importedAccount.Held, err)
+	}
+	if err := imported.Void(voided.ID); !errors.Is(err, ErrHoldNotActive) {
+		t.Errorf("Void(): must return ErrHoldNotActive, returned = %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package wallet
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger receives service events, keyvals are pairs of field name and value
+// like "account_id", 1, "payment_id", "..."
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Level of log events
+type Level int
+
+// Log levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses level name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelDebug, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetLogger sets the logger of service events, nil disables logging
+func (s *Service) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
+// log returns the service logger, by default events are dropped
+func (s *Service) log() Logger {
+	if s.logger == nil {
+		return nopLogger{}
+	}
+	return s.logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// TextLogger writes events of level or above as lines of
+// "time level message key=value ..."
+type TextLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// NewTextLogger creates logger writing to w
+func NewTextLogger(w io.Writer, level Level) *TextLogger {
+	return &TextLogger{w: w, level: level}
+}
+
+// Debug logs debug event
+func (l *TextLogger) Debug(msg string, keyvals ...interface{}) {
+	l.write(LevelDebug, msg, keyvals)
+}
+
+// Info logs info event
+func (l *TextLogger) Info(msg string, keyvals ...interface{}) {
+	l.write(LevelInfo, msg, keyvals)
+}
+
+// Warn logs warning event
+func (l *TextLogger) Warn(msg string, keyvals ...interface{}) {
+	l.write(LevelWarn, msg, keyvals)
+}
+
+// Error logs error event
+func (l *TextLogger) Error(msg string, keyvals ...interface{}) {
+	l.write(LevelError, msg, keyvals)
+}
+
+func (l *TextLogger) write(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	line := time.Now().UTC().Format(time.RFC3339) + " " + level.String() + " " + fmt.Sprintf("%q", msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		line += fmt.Sprintf(" %v=%q", keyvals[i], fmt.Sprint(value))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, line)
+}
@@ -0,0 +1,82 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testLogger struct {
+	events []string
+}
+
+func (l *testLogger) add(level string, msg string, keyvals []interface{}) {
+	event := level + " " + msg
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		event += fmt.Sprintf(" %v=%v", keyvals[i], keyvals[i+1])
+	}
+	l.events = append(l.events, event)
+}
+
+func (l *testLogger) Debug(msg string, keyvals ...interface{}) { l.add("debug", msg, keyvals) }
+func (l *testLogger) Info(msg string, keyvals ...interface{})  { l.add("info", msg, keyvals) }
+func (l *testLogger) Warn(msg string, keyvals ...interface{})  { l.add("warn", msg, keyvals) }
+func (l *testLogger) Error(msg string, keyvals ...interface{}) { l.add("error", msg, keyvals) }
+
+func TestService_SetLogger_events(t *testing.T) {
+	s := newTestService()
+	logger := &testLogger{}
+	s.SetLogger(logger)
+
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.Reject(payments[0].ID)
+	if err != nil {
+		t.Errorf("Reject(): error = %v", err)
+		return
+	}
+	_, err = s.Pay(account.ID, 100_000_00, "car")
+	if !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+		return
+	}
+
+	want := []string{
+		"info payment created account_id=1 payment_id=" + payments[0].ID + " amount=100000 category=cat",
+		"info payment rejected account_id=1 payment_id=" + payments[0].ID + " refunded=100000",
+		"warn payment failed account_id=1 amount=10000000 category=car error=not enough balance",
+	}
+	if strings.Join(logger.events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("SetLogger(): want events = %v, got = %v", want, logger.events)
+	}
+}
+
+func TestTextLogger_level(t *testing.T) {
+	buf := &bytes.Buffer{}
+	level, err := ParseLevel("WARN")
+	if err != nil {
+		t.Errorf("ParseLevel(): error = %v", err)
+		return
+	}
+	logger := NewTextLogger(buf, level)
+
+	logger.Info("payment created", "account_id", 1)
+	logger.Error("export failed", "path", "data/accounts.dump", "error", ErrFileNotFound)
+
+	got := buf.String()
+	if strings.Contains(got, "payment created") {
+		t.Errorf("TextLogger: info event must be skipped, got = %v", got)
+	}
+	if !strings.Contains(got, `error "export failed" path="data/accounts.dump" error="file not found"`) {
+		t.Errorf("TextLogger: wrong line = %v", got)
+	}
+
+	if _, err = ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(): must return error for unknown level, returned nil")
+	}
+}
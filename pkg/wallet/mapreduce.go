@@ -0,0 +1,346 @@
+package wallet
+
+import (
+	"context"
+	"sync"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// Job is a computation over payments run by MapReduce. Payments accepted by
+// Filter, nil accepts all, are turned into values by Map. Reduce adds a value
+// to the result of a chunk, the result is nil before the first value. Merge
+// joins results of chunks in chunk order, nil Merge means Reduce is used.
+// Progress, when set, is called by the goroutine of every chunk which is
+// done with count of its payments and its result, so calls are concurrent
+type Job struct {
+	Filter   func(payment types.Payment) bool
+	Map      func(payment types.Payment) interface{}
+	Reduce   func(result interface{}, value interface{}) interface{}
+	Merge    func(result interface{}, part interface{}) interface{}
+	Progress func(chunk int, payments int, result interface{})
+}
+
+// MapReduce runs job over payments in goroutines, it returns nil when no payment is accepted
+func (s *Service) MapReduce(job Job, goroutines int) interface{} {
+	result, _ := s.MapReduceContext(context.Background(), job, goroutines)
+	return result
+}
+
+// MapReduceContext runs job like MapReduce, goroutines exit when ctx is done.
+// Payments are split into chunks of the same size, one for each goroutine,
+// goroutines below 1 mean one and above count of payments mean one per payment
+func (s *Service) MapReduceContext(ctx context.Context, job Job, goroutines int) (result interface{}, err error) {
+	defer wrapError(&err, "MapReduce", 0, "")
+
+	total := len(s.payments)
+	goroutines = chunkCount(goroutines, total)
+
+	parts := make([]interface{}, goroutines)
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(part int, payments []*types.Payment) {
+			defer wg.Done()
+			var result interface{}
+			for j, payment := range payments {
+				if canceled(ctx, j) {
+					return
+				}
+				if job.Filter != nil && !job.Filter(*payment) {
+					continue
+				}
+				result = job.Reduce(result, job.Map(*payment))
+			}
+			parts[part] = result
+			if job.Progress != nil {
+				job.Progress(part, len(payments), result)
+			}
+		}(i, s.payments[i*total/goroutines:(i+1)*total/goroutines])
+	}
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	merge := job.Merge
+	if merge == nil {
+		merge = job.Reduce
+	}
+	for _, part := range parts {
+		switch {
+		case part == nil:
+		case result == nil:
+			result = part
+		default:
+			result = merge(result, part)
+		}
+	}
+	return result, nil
+}
+
+// chunkCount returns how many chunks MapReduceContext makes of total payments
+func chunkCount(goroutines int, total int) int {
+	if goroutines > total {
+		goroutines = total
+	}
+	if goroutines < 1 {
+		goroutines = 1
+	}
+	return goroutines
+}
+
+// sumJob sums amounts of payments accepted by filter
+func sumJob(filter func(payment types.Payment) bool) Job {
+	return Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return payment.Amount
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			if result == nil {
+				return value
+			}
+			return result.(types.Money) + value.(types.Money)
+		},
+	}
+}
+
+// countJob counts payments accepted by filter
+func countJob(filter func(payment types.Payment) bool) Job {
+	return Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return 1
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			if result == nil {
+				return value
+			}
+			return result.(int) + value.(int)
+		},
+	}
+}
+
+// collectJob collects payments accepted by filter keeping their order
+func collectJob(filter func(payment types.Payment) bool) Job {
+	return Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return payment
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			payments, _ := result.([]types.Payment)
+			return append(payments, value.(types.Payment))
+		},
+		Merge: func(result interface{}, part interface{}) interface{} {
+			return append(result.([]types.Payment), part.([]types.Payment)...)
+		},
+	}
+}
+
+// pickJob finds the payment which is kept by better among payments accepted
+// by filter, of equal payments the first one is kept
+func pickJob(filter func(payment types.Payment) bool, better func(payment, than types.Payment) bool) Job {
+	return Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return payment
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			if result == nil || better(value.(types.Payment), result.(types.Payment)) {
+				return value
+			}
+			return result
+		},
+	}
+}
+
+// CountPayments counts payments accepted by filter, nil filter counts all
+func (s *Service) CountPayments(filter func(payment types.Payment) bool, goroutines int) int {
+	count, _ := s.CountPaymentsContext(context.Background(), filter, goroutines)
+	return count
+}
+
+// CountPaymentsContext counts like CountPayments, goroutines exit when ctx is done
+func (s *Service) CountPaymentsContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) (count int, err error) {
+	defer wrapError(&err, "CountPayments", 0, "")
+
+	result, err := s.MapReduceContext(ctx, countJob(filter), goroutines)
+	if result == nil {
+		return 0, err
+	}
+	return result.(int), err
+}
+
+// MinPayment returns the smallest payment accepted by filter
+func (s *Service) MinPayment(filter func(payment types.Payment) bool, goroutines int) (types.Payment, error) {
+	return s.MinPaymentContext(context.Background(), filter, goroutines)
+}
+
+// MinPaymentContext finds like MinPayment, goroutines exit when ctx is done
+func (s *Service) MinPaymentContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) (types.Payment, error) {
+	return s.pickPayment(ctx, "MinPayment", pickJob(filter, func(payment, than types.Payment) bool {
+		return payment.Amount < than.Amount
+	}), goroutines)
+}
+
+// MaxPayment returns the largest payment accepted by filter
+func (s *Service) MaxPayment(filter func(payment types.Payment) bool, goroutines int) (types.Payment, error) {
+	return s.MaxPaymentContext(context.Background(), filter, goroutines)
+}
+
+// MaxPaymentContext finds like MaxPayment, goroutines exit when ctx is done
+func (s *Service) MaxPaymentContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) (types.Payment, error) {
+	return s.pickPayment(ctx, "MaxPayment", pickJob(filter, func(payment, than types.Payment) bool {
+		return payment.Amount > than.Amount
+	}), goroutines)
+}
+
+// pickPayment runs pickJob, ErrPaymentNotFound is returned when no payment is accepted
+func (s *Service) pickPayment(ctx context.Context, op string, job Job, goroutines int) (payment types.Payment, err error) {
+	defer wrapError(&err, op, 0, "")
+
+	result, err := s.MapReduceContext(ctx, job, goroutines)
+	if err != nil {
+		return payment, err
+	}
+	if result == nil {
+		return payment, ErrPaymentNotFound
+	}
+	return result.(types.Payment), nil
+}
+
+// average is sum and count of payments
+type average struct {
+	sum   types.Money
+	count int
+}
+
+// AveragePayment returns average amount of payments accepted by filter,
+// ErrPaymentNotFound is returned when no payment is accepted
+func (s *Service) AveragePayment(filter func(payment types.Payment) bool, goroutines int) (types.Money, error) {
+	return s.AveragePaymentContext(context.Background(), filter, goroutines)
+}
+
+// AveragePaymentContext computes like AveragePayment, goroutines exit when ctx is done
+func (s *Service) AveragePaymentContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) (avg types.Money, err error) {
+	defer wrapError(&err, "AveragePayment", 0, "")
+
+	result, err := s.MapReduceContext(ctx, Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return average{sum: payment.Amount, count: 1}
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			if result == nil {
+				return value
+			}
+			return average{
+				sum:   result.(average).sum + value.(average).sum,
+				count: result.(average).count + value.(average).count,
+			}
+		},
+	}, goroutines)
+	if err != nil {
+		return 0, err
+	}
+	if result == nil {
+		return 0, ErrPaymentNotFound
+	}
+	return result.(average).sum / types.Money(result.(average).count), nil
+}
+
+// GroupPayments splits payments accepted by filter into groups by key and
+// reduces values of every group by reducer, value of payment is made by mapper.
+// Results of groups in chunks are joined by reducer too, so results must be of
+// the same type as values
+func (s *Service) GroupPayments(
+	filter func(payment types.Payment) bool,
+	key func(payment types.Payment) string,
+	mapper func(payment types.Payment) interface{},
+	reducer func(result interface{}, value interface{}) interface{},
+	goroutines int,
+) map[string]interface{} {
+	groups, _ := s.GroupPaymentsContext(context.Background(), filter, key, mapper, reducer, goroutines)
+	return groups
+}
+
+// GroupPaymentsContext groups like GroupPayments, goroutines exit when ctx is done
+func (s *Service) GroupPaymentsContext(
+	ctx context.Context,
+	filter func(payment types.Payment) bool,
+	key func(payment types.Payment) string,
+	mapper func(payment types.Payment) interface{},
+	reducer func(result interface{}, value interface{}) interface{},
+	goroutines int,
+) (groups map[string]interface{}, err error) {
+	defer wrapError(&err, "GroupPayments", 0, "")
+
+	type keyed struct {
+		key   string
+		value interface{}
+	}
+	result, err := s.MapReduceContext(ctx, Job{
+		Filter: filter,
+		Map: func(payment types.Payment) interface{} {
+			return keyed{key: key(payment), value: mapper(payment)}
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			groups, ok := result.(map[string]interface{})
+			if !ok {
+				groups = map[string]interface{}{}
+			}
+			item := value.(keyed)
+			if group, ok := groups[item.key]; ok {
+				groups[item.key] = reducer(group, item.value)
+			} else {
+				groups[item.key] = reducer(nil, item.value)
+			}
+			return groups
+		},
+		Merge: func(result interface{}, part interface{}) interface{} {
+			groups := result.(map[string]interface{})
+			for key, value := range part.(map[string]interface{}) {
+				if group, ok := groups[key]; ok {
+					groups[key] = reducer(group, value)
+				} else {
+					groups[key] = value
+				}
+			}
+			return groups
+		},
+	}, goroutines)
+	if err != nil {
+		return nil, err
+	}
+	groups, _ = result.(map[string]interface{})
+	if groups == nil {
+		groups = map[string]interface{}{}
+	}
+	return groups, nil
+}
+
+// SumPaymentsByCategory sums amounts of payments by category
+func (s *Service) SumPaymentsByCategory(goroutines int) map[types.PaymentCategory]types.Money {
+	sums, _ := s.SumPaymentsByCategoryContext(context.Background(), goroutines)
+	return sums
+}
+
+// SumPaymentsByCategoryContext sums like SumPaymentsByCategory, goroutines exit when ctx is done
+func (s *Service) SumPaymentsByCategoryContext(ctx context.Context, goroutines int) (sums map[types.PaymentCategory]types.Money, err error) {
+	defer wrapError(&err, "SumPaymentsByCategory", 0, "")
+
+	job := sumJob(nil)
+	groups, err := s.GroupPaymentsContext(ctx, nil, func(payment types.Payment) string {
+		return string(payment.Category)
+	}, job.Map, job.Reduce, goroutines)
+	if err != nil {
+		return nil, err
+	}
+	sums = make(map[types.PaymentCategory]types.Money, len(groups))
+	for category, sum := range groups {
+		sums[types.PaymentCategory(category)] = sum.(types.Money)
+	}
+	return sums, nil
+}
@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// goroutineCounts are worker counts of tests, 0 and more than payments included
+var goroutineCounts = []int{0, 1, 2, 3, 7, 100, 1000}
+
+func TestService_MapReduce_serial(t *testing.T) {
+	s := newProgressTestService(t, 100)
+	filter := func(payment types.Payment) bool {
+		return payment.Category != "auto"
+	}
+
+	var sum, filteredSum types.Money
+	count := 0
+	min, max := s.payments[0], s.payments[0]
+	categories := map[types.PaymentCategory]types.Money{}
+	var filtered []types.Payment
+	for _, payment := range s.payments {
+		sum += payment.Amount
+		categories[payment.Category] += payment.Amount
+		if payment.Amount < min.Amount {
+			min = payment
+		}
+		if payment.Amount > max.Amount {
+			max = payment
+		}
+		if filter(*payment) {
+			count++
+			filteredSum += payment.Amount
+			filtered = append(filtered, *payment)
+		}
+	}
+
+	for _, goroutines := range goroutineCounts {
+		if got := s.SumPayments(goroutines); got != sum {
+			t.Errorf("SumPayments(%v) = %v, want %v", goroutines, got, sum)
+		}
+		if got := s.CountPayments(filter, goroutines); got != count {
+			t.Errorf("CountPayments(%v) = %v, want %v", goroutines, got, count)
+		}
+		if got, err := s.MinPayment(nil, goroutines); err != nil || got != *min {
+			t.Errorf("MinPayment(%v) = %v, error = %v, want %v", goroutines, got, err, *min)
+		}
+		if got, err := s.MaxPayment(nil, goroutines); err != nil || got != *max {
+			t.Errorf("MaxPayment(%v) = %v, error = %v, want %v", goroutines, got, err, *max)
+		}
+		if got, err := s.AveragePayment(filter, goroutines); err != nil || got != filteredSum/types.Money(count) {
+			t.Errorf("AveragePayment(%v) = %v, error = %v", goroutines, got, err)
+		}
+		if got := s.SumPaymentsByCategory(goroutines); !reflect.DeepEqual(got, categories) {
+			t.Errorf("SumPaymentsByCategory(%v) = %v, want %v", goroutines, got, categories)
+		}
+		if got, err := s.FilterPaymentsByFn(filter, goroutines); err != nil || !reflect.DeepEqual(got, filtered) {
+			t.Errorf("FilterPaymentsByFn(%v): wrong payments, error = %v", goroutines, err)
+		}
+	}
+}
+
+func TestService_MapReduce_empty(t *testing.T) {
+	s := &Service{}
+	for _, goroutines := range goroutineCounts {
+		if got := s.SumPayments(goroutines); got != 0 {
+			t.Errorf("SumPayments(%v) = %v", goroutines, got)
+		}
+		if got := s.CountPayments(nil, goroutines); got != 0 {
+			t.Errorf("CountPayments(%v) = %v", goroutines, got)
+		}
+		if _, err := s.MinPayment(nil, goroutines); !errors.Is(err, ErrPaymentNotFound) {
+			t.Errorf("MinPayment(%v): must return ErrPaymentNotFound, returned = %v", goroutines, err)
+		}
+		if _, err := s.AveragePayment(nil, goroutines); !errors.Is(err, ErrPaymentNotFound) {
+			t.Errorf("AveragePayment(%v): must return ErrPaymentNotFound, returned = %v", goroutines, err)
+		}
+		if got := s.SumPaymentsByCategory(goroutines); len(got) != 0 {
+			t.Errorf("SumPaymentsByCategory(%v) = %v", goroutines, got)
+		}
+	}
+}
+
+func TestService_MapReduceContext_canceled(t *testing.T) {
+	s := newProgressTestService(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.MapReduceContext(ctx, sumJob(nil), 4)
+	if !errors.Is(err, context.Canceled) || KindOf(err) != KindCanceled {
+		t.Errorf("MapReduceContext(): must return context.Canceled, returned = %v", err)
+	}
+	_, err = s.CountPaymentsContext(ctx, nil, 4)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CountPaymentsContext(): must return context.Canceled, returned = %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidMerchant = errors.New("invalid merchant")
+var ErrMerchantNotFound = errors.New("merchant not found")
+var ErrMerchantNameTaken = errors.New("merchant name is taken")
+var ErrNothingToSettle = errors.New("merchant has nothing to settle")
+
+// RegisterMerchant registers merchant which receives payments in category,
+// names are unique ignoring case and the settlement account must exist
+func (s *Service) RegisterMerchant(name string, category types.PaymentCategory, settlementAccountID int64) (merchant *types.Merchant, err error) {
+	defer wrapError(&err, "RegisterMerchant", settlementAccountID, "")
+	defer s.startAudit("RegisterMerchant", settlementAccountID, 0, name, category).finish(&err)
+
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, ";\n") {
+		return nil, fmt.Errorf("%w: name %q must not be empty or have ; or line break", ErrInvalidMerchant, name)
+	}
+	for _, merchant := range s.merchants {
+		if strings.EqualFold(merchant.Name, name) {
+			return nil, ErrMerchantNameTaken
+		}
+	}
+	if category == "" {
+		return nil, fmt.Errorf("%w: category is required", ErrInvalidMerchant)
+	}
+	if category, err = s.resolveCategory(category); err != nil {
+		return nil, err
+	}
+	if _, err = s.FindAccountByID(settlementAccountID); err != nil {
+		return nil, err
+	}
+
+	merchant = &types.Merchant{
+		ID:                  uuid.New().String(),
+		Name:                name,
+		Category:            category,
+		SettlementAccountID: settlementAccountID,
+	}
+	s.merchants = append(s.merchants, merchant)
+	return merchant, nil
+}
+
+// FindMerchantByID find merchant by id
+func (s *Service) FindMerchantByID(merchantID string) (merchant *types.Merchant, err error) {
+	defer wrapError(&err, "FindMerchantByID", 0, "")
+
+	for _, merchant := range s.merchants {
+		if merchant.ID == merchantID {
+			return merchant, nil
+		}
+	}
+	return nil, ErrMerchantNotFound
+}
+
+// Merchants returns registered merchants in order of registration
+func (s *Service) Merchants() []types.Merchant {
+	merchants := make([]types.Merchant, 0, len(s.merchants))
+	for _, merchant := range s.merchants {
+		merchants = append(merchants, *merchant)
+	}
+	return merchants
+}
+
+// PayMerchant pays amount from account to merchant in category of merchant,
+// amount is credited to merchant and fee stays with the wallet. Accounts with
+// credential must use PayMerchantWithCredential for amounts above the auth threshold
+func (s *Service) PayMerchant(accountID int64, merchantID string, amount types.Money) (*types.Payment, error) {
+	return s.payMerchant(accountID, merchantID, amount, nil)
+}
+
+// PayMerchantWithCredential pays merchant confirmed by credential
+func (s *Service) PayMerchantWithCredential(accountID int64, merchantID string, amount types.Money, auth types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "PayMerchantWithCredential", accountID, "")
+
+	return s.payMerchant(accountID, merchantID, amount, &auth)
+}
+
+func (s *Service) payMerchant(accountID int64, merchantID string, amount types.Money, auth *types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "PayMerchant", accountID, "")
+	defer s.startAudit("PayMerchant", accountID, 0, merchantID, amount).finish(&err)
+
+	merchant, err := s.FindMerchantByID(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return s.pay(accountID, amount, merchant.Category, merchant, "", auth)
+}
+
+// MerchantPayments returns payments to merchant in order of payments,
+// merchant without payments has empty list
+func (s *Service) MerchantPayments(merchantID string) (payments []types.Payment, err error) {
+	defer wrapError(&err, "MerchantPayments", 0, "")
+
+	if _, err = s.FindMerchantByID(merchantID); err != nil {
+		return nil, err
+	}
+	payments = []types.Payment{}
+	for _, i := range s.updatePaymentIndex().byMerchant[merchantID] {
+		payments = append(payments, *s.payments[i])
+	}
+	return payments, nil
+}
+
+// SettleMerchant moves balance of merchant to its settlement account
+func (s *Service) SettleMerchant(merchantID string) (settlement *types.Settlement, err error) {
+	defer wrapError(&err, "SettleMerchant", s.accountOfMerchant(merchantID), "")
+	defer s.startAudit("SettleMerchant", s.accountOfMerchant(merchantID), 0, merchantID).finish(&err)
+
+	merchant, err := s.FindMerchantByID(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	if merchant.Balance <= 0 {
+		return nil, ErrNothingToSettle
+	}
+	account, err := s.FindAccountByID(merchant.SettlementAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	settlement = &types.Settlement{
+		ID:         uuid.New().String(),
+		MerchantID: merchant.ID,
+		AccountID:  account.ID,
+		Amount:     merchant.Balance,
+		CreatedAt:  s.currentTime(),
+	}
+	account.Balance += settlement.Amount
+	merchant.Balance = 0
+	s.settlements = append(s.settlements, settlement)
+	s.log().Info("merchant settled", "merchant_id", merchant.ID, "account_id", account.ID, "amount", settlement.Amount)
+	return settlement, nil
+}
+
+// SettlementReport sums payments to merchant and settlements made from
+// from till to, zero times do not limit. Failed payments are skipped
+func (s *Service) SettlementReport(merchantID string, from time.Time, to time.Time) (report types.SettlementReport, err error) {
+	defer wrapError(&err, "SettlementReport", 0, "")
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return report, fmt.Errorf("%w: to is before from", ErrInvalidReport)
+	}
+	merchant, err := s.FindMerchantByID(merchantID)
+	if err != nil {
+		return report, err
+	}
+	within := func(t time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+	}
+
+	report = types.SettlementReport{MerchantID: merchant.ID, From: from, To: to, Balance: merchant.Balance}
+	for _, i := range s.updatePaymentIndex().byMerchant[merchantID] {
+		payment := s.payments[i]
+		if payment.Status == types.PaymentStatusFail || !within(payment.CreatedAt) {
+			continue
+		}
+		report.Count++
+		report.Gross += payment.Amount
+		report.Refunded += s.refundedAmount(payment.ID)
+	}
+	report.Net = report.Gross - report.Refunded
+	for _, settlement := range s.settlements {
+		if settlement.MerchantID == merchantID && within(settlement.CreatedAt) {
+			report.Settled += settlement.Amount
+		}
+	}
+	return report, nil
+}
+
+// debitMerchant takes amount returned to payer of payment from its merchant,
+// balance of settled merchant may become negative
+func (s *Service) debitMerchant(payment *types.Payment, amount types.Money) {
+	if payment.MerchantID == "" || amount == 0 {
+		return
+	}
+	for _, merchant := range s.merchants {
+		if merchant.ID == payment.MerchantID {
+			merchant.Balance -= amount
+			s.log().Info("merchant debited", "merchant_id", merchant.ID, "payment_id", payment.ID, "amount", amount)
+			return
+		}
+	}
+}
+
+// merchantRecords converts merchants to dump records
+func (s *Service) merchantRecords() [][]string {
+	records := make([][]string, 0, len(s.merchants))
+	for _, merchant := range s.merchants {
+		records = append(records, []string{
+			merchant.ID,
+			merchant.Name,
+			string(merchant.Category),
+			strconv.FormatInt(merchant.SettlementAccountID, 10),
+			strconv.FormatInt(int64(merchant.Balance), 10),
+		})
+	}
+	return records
+}
+
+// importMerchants restores merchants from dump records
+func (s *Service) importMerchants(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("merchant record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		balance, err := strconv.ParseInt(record[4], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.merchants = append(s.merchants, &types.Merchant{
+			ID:                  record[0],
+			Name:                record[1],
+			Category:            types.PaymentCategory(record[2]),
+			SettlementAccountID: accountID,
+			Balance:             types.Money(balance),
+		})
+	}
+	return nil
+}
+
+// settlementRecords converts settlements to dump records, times are unix seconds
+func (s *Service) settlementRecords() [][]string {
+	records := make([][]string, 0, len(s.settlements))
+	for _, settlement := range s.settlements {
+		records = append(records, []string{
+			settlement.ID,
+			settlement.MerchantID,
+			strconv.FormatInt(settlement.AccountID, 10),
+			strconv.FormatInt(int64(settlement.Amount), 10),
+			strconv.FormatInt(settlement.CreatedAt.Unix(), 10),
+		})
+	}
+	return records
+}
+
+// importSettlements restores settlements from dump records
+func (s *Service) importSettlements(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("settlement record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		createdAt, err := strconv.ParseInt(record[4], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.settlements = append(s.settlements, &types.Settlement{
+			ID:         record[0],
+			MerchantID: record[1],
+			AccountID:  accountID,
+			Amount:     types.Money(amount),
+			CreatedAt:  time.Unix(createdAt, 0),
+		})
+	}
+	return nil
+}
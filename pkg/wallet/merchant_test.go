@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// newMerchantTestService registers payer account 1 and account 2 which
+// receives settlements of merchant in food
+func newMerchantTestService(t *testing.T) (*Service, *types.Merchant) {
+	s := &Service{}
+	now := time.Date(2020, 1, 30, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	payer, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Deposit(payer.ID, 100_000)
+	owner, err := s.RegisterAccount("+992938638677")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merchant, err := s.RegisterMerchant(" Coffee House ", "food", owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, merchant
+}
+
+func TestService_PayMerchant(t *testing.T) {
+	s, merchant := newMerchantTestService(t)
+
+	first, err := s.PayMerchant(1, merchant.ID, 300)
+	if err != nil || first.MerchantID != merchant.ID || first.Category != "food" {
+		t.Errorf("PayMerchant(): payment = %+v, error = %v", first, err)
+		return
+	}
+	second, _ := s.PayMerchant(1, merchant.ID, 200)
+	s.Pay(1, 1000, "food")
+	if merchant.Name != "Coffee House" || merchant.Balance != 500 {
+		t.Errorf("PayMerchant(): merchant = %+v", merchant)
+	}
+
+	if _, err := s.Refund(first.ID, 50); err != nil {
+		t.Error(err)
+	}
+	if err := s.Reject(second.ID); err != nil {
+		t.Error(err)
+	}
+	if merchant.Balance != 250 {
+		t.Errorf("Reject(): merchant must be debited, balance = %v", merchant.Balance)
+	}
+	repeated, err := s.Repeat(first.ID)
+	if err != nil || repeated.MerchantID != merchant.ID || merchant.Balance != 550 {
+		t.Errorf("Repeat(): payment = %+v, balance = %v, error = %v", repeated, merchant.Balance, err)
+	}
+
+	payments, err := s.MerchantPayments(merchant.ID)
+	if err != nil || len(payments) != 3 || payments[0].ID != first.ID || payments[2].ID != repeated.ID {
+		t.Errorf("MerchantPayments(): payments = %v, error = %v", payments, err)
+	}
+
+	settlement, err := s.SettleMerchant(merchant.ID)
+	owner, _ := s.FindAccountByID(2)
+	if err != nil || settlement.Amount != 550 || owner.Balance != 550 || merchant.Balance != 0 {
+		t.Errorf("SettleMerchant(): settlement = %+v, owner = %+v, error = %v", settlement, owner, err)
+	}
+	_, err = s.SettleMerchant(merchant.ID)
+	if !errors.Is(err, ErrNothingToSettle) || KindOf(err) != KindConflict {
+		t.Errorf("SettleMerchant(): must return ErrNothingToSettle, returned = %v", err)
+	}
+
+	report, err := s.SettlementReport(merchant.ID, time.Time{}, time.Time{})
+	want := types.SettlementReport{MerchantID: merchant.ID, Count: 2, Gross: 600, Refunded: 50, Net: 550, Settled: 550}
+	if err != nil || !reflect.DeepEqual(report, want) {
+		t.Errorf("SettlementReport(): report = %+v, want %+v, error = %v", report, want, err)
+	}
+	report, err = s.SettlementReport(merchant.ID, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+	if err != nil || report.Count != 0 || report.Settled != 0 {
+		t.Errorf("SettlementReport(): report of the next month = %+v, error = %v", report, err)
+	}
+
+	// refund of settled payment is owed by merchant
+	if _, err := s.Refund(repeated.ID, 100); err != nil {
+		t.Error(err)
+	}
+	if merchant.Balance != -100 {
+		t.Errorf("Refund(): merchant balance = %v", merchant.Balance)
+	}
+}
+
+func TestService_RegisterMerchant_invalid(t *testing.T) {
+	s, merchant := newMerchantTestService(t)
+
+	tests := []struct {
+		name     string
+		category types.PaymentCategory
+		account  int64
+		err      error
+	}{
+		{" ", "food", 2, ErrInvalidMerchant},
+		{"Tea;House", "food", 2, ErrInvalidMerchant},
+		{"COFFEE HOUSE", "food", 2, ErrMerchantNameTaken},
+		{"Tea House", "", 2, ErrInvalidMerchant},
+		{"Tea House", "food", 3, ErrAccountNotFound},
+	}
+	for _, test := range tests {
+		_, err := s.RegisterMerchant(test.name, test.category, test.account)
+		if !errors.Is(err, test.err) {
+			t.Errorf("RegisterMerchant(%q): must return %v, returned = %v", test.name, test.err, err)
+		}
+	}
+
+	s.RegisterCategory(types.Category{ID: "food"})
+	if _, err := s.RegisterMerchant("Tea House", "fod", 2); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("RegisterMerchant(): must return ErrUnknownCategory, returned = %v", err)
+	}
+	if _, err := s.PayMerchant(1, "unknown", 100); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("PayMerchant(): must return ErrMerchantNotFound, returned = %v", err)
+	}
+	if _, err := s.PayMerchant(1, merchant.ID, 1_000_000); !errors.Is(err, ErrNotEnoughBalance) || merchant.Balance != 0 {
+		t.Errorf("PayMerchant(): must return ErrNotEnoughBalance, balance = %v, returned = %v", merchant.Balance, err)
+	}
+	payments, err := s.MerchantPayments(merchant.ID)
+	if err != nil || payments == nil || len(payments) != 0 {
+		t.Errorf("MerchantPayments(): must return empty list, payments = %v, error = %v", payments, err)
+	}
+	if _, err := s.MerchantPayments("unknown"); !errors.Is(err, ErrMerchantNotFound) {
+		t.Errorf("MerchantPayments(): must return ErrMerchantNotFound, returned = %v", err)
+	}
+}
+
+func TestService_Export_merchants(t *testing.T) {
+	s, merchant := newMerchantTestService(t)
+	payment, _ := s.PayMerchant(1, merchant.ID, 300)
+	s.SettleMerchant(merchant.ID)
+	s.PayMerchant(1, merchant.ID, 200)
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if got := imported.Merchants(); !reflect.DeepEqual(got, s.Merchants()) {
+		t.Errorf("Import(): merchants = %+v, want %+v", got, s.Merchants())
+	}
+	payments, err := imported.MerchantPayments(merchant.ID)
+	if err != nil || len(payments) != 2 || payments[0].ID != payment.ID {
+		t.Errorf("Import(): payments = %v, error = %v", payments, err)
+	}
+	report, err := imported.SettlementReport(merchant.ID, time.Time{}, time.Time{})
+	if err != nil || report.Settled != 300 || report.Balance != 200 {
+		t.Errorf("Import(): report = %+v, error = %v", report, err)
+	}
+}
+
+func TestService_SettleMerchant_audit(t *testing.T) {
+	s, merchant := newMerchantTestService(t)
+	s.PayMerchant(1, merchant.ID, 300)
+	if _, err := s.SettleMerchant(merchant.ID); err != nil {
+		t.Errorf("SettleMerchant(): error = %v", err)
+		return
+	}
+
+	records := s.AuditLog(merchant.SettlementAccountID, time.Time{}, time.Time{})
+	last := records[len(records)-1]
+	if last.Operation != "SettleMerchant" || last.BalanceBefore != 0 || last.BalanceAfter != 300 {
+		t.Errorf("AuditLog(): wrong record = %+v", last)
+	}
+}
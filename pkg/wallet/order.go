@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidOrder = errors.New("invalid payment order")
+
+// PaymentOrder is sort key of payments, "-" before key sorts in descending order
+type PaymentOrder string
+
+const (
+	OrderInserted    PaymentOrder = ""
+	OrderAmount      PaymentOrder = "amount"
+	OrderAmountDesc  PaymentOrder = "-amount"
+	OrderCategory    PaymentOrder = "category"
+	OrderID          PaymentOrder = "id"
+	OrderCreated     PaymentOrder = "created"
+	OrderCreatedDesc PaymentOrder = "-created"
+)
+
+// paymentLess compares payments by ascending orders
+var paymentLess = map[PaymentOrder]func(a, b types.Payment) bool{
+	OrderAmount:   func(a, b types.Payment) bool { return a.Amount < b.Amount },
+	OrderCategory: func(a, b types.Payment) bool { return a.Category < b.Category },
+	OrderID:       func(a, b types.Payment) bool { return a.ID < b.ID },
+	OrderCreated:  func(a, b types.Payment) bool { return a.CreatedAt.Before(b.CreatedAt) },
+}
+
+// lessOf returns comparison of payments by order, nil for OrderInserted
+func lessOf(order PaymentOrder) (func(a, b types.Payment) bool, error) {
+	if order == OrderInserted {
+		return nil, nil
+	}
+	if strings.HasPrefix(string(order), "-") {
+		less, ok := paymentLess[order[1:]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidOrder, order)
+		}
+		return func(a, b types.Payment) bool { return less(b, a) }, nil
+	}
+	less, ok := paymentLess[order]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOrder, order)
+	}
+	return less, nil
+}
+
+// SortPayments sorts payments by order, equal payments keep their order
+// and OrderInserted leaves payments as they are
+func SortPayments(payments []types.Payment, order PaymentOrder) error {
+	less, err := lessOf(order)
+	if less == nil {
+		return err
+	}
+	sort.SliceStable(payments, func(i, j int) bool {
+		return less(payments[i], payments[j])
+	})
+	return nil
+}
+
+// FilterPaymentsSorted filters payments of account like FilterPayments and sorts them by order
+func (s *Service) FilterPaymentsSorted(accountID int64, order PaymentOrder, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsSortedContext(context.Background(), accountID, order, goroutines)
+}
+
+// FilterPaymentsSortedContext filters like FilterPaymentsSorted, goroutines exit when ctx is done
+func (s *Service) FilterPaymentsSortedContext(ctx context.Context, accountID int64, order PaymentOrder, goroutines int) (payments []types.Payment, err error) {
+	defer wrapError(&err, "FilterPaymentsSorted", accountID, "")
+
+	if _, err = lessOf(order); err != nil {
+		return nil, err
+	}
+	payments, err = s.FilterPaymentsContext(ctx, accountID, goroutines)
+	if err != nil {
+		return nil, err
+	}
+	return payments, SortPayments(payments, order)
+}
@@ -0,0 +1,80 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_FilterPayments_order(t *testing.T) {
+	s := newProgressTestService(t, 50)
+	want := make([]types.Payment, len(s.payments))
+	for i, payment := range s.payments {
+		want[i] = *payment
+	}
+
+	for _, goroutines := range goroutineCounts {
+		for i := 0; i < 5; i++ {
+			payments, err := s.FilterPayments(1, goroutines)
+			if err != nil || !reflect.DeepEqual(payments, want) {
+				t.Errorf("FilterPayments(%v): payments are not in insertion order, error = %v", goroutines, err)
+			}
+		}
+	}
+}
+
+func TestService_FilterPayments_empty(t *testing.T) {
+	s := &Service{}
+	account, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, goroutines := range goroutineCounts {
+		payments, err := s.FilterPayments(account.ID, goroutines)
+		if err != nil || payments == nil || len(payments) != 0 {
+			t.Errorf("FilterPayments(%v): must return empty list, payments = %v, error = %v", goroutines, payments, err)
+		}
+		_, err = s.FilterPayments(account.ID+1, goroutines)
+		if !errors.Is(err, ErrAccountNotFound) {
+			t.Errorf("FilterPayments(%v): must return ErrAccountNotFound, returned = %v", goroutines, err)
+		}
+		payments, err = s.FilterPaymentsByFn(func(payment types.Payment) bool { return true }, goroutines)
+		if err != nil || payments == nil || len(payments) != 0 {
+			t.Errorf("FilterPaymentsByFn(%v): must return empty list, payments = %v, error = %v", goroutines, payments, err)
+		}
+	}
+
+	history, err := s.ExportAccountHistory(account.ID)
+	if err != nil || history == nil || len(history) != 0 {
+		t.Errorf("ExportAccountHistory(): must return empty list, history = %v, error = %v", history, err)
+	}
+}
+
+func TestService_FilterPaymentsSorted(t *testing.T) {
+	s := newProgressTestService(t, 9)
+
+	payments, err := s.FilterPaymentsSorted(1, OrderAmountDesc, 4)
+	if err != nil || len(payments) != 9 {
+		t.Errorf("FilterPaymentsSorted(): payments = %v, error = %v", payments, err)
+		return
+	}
+	for i := 1; i < len(payments); i++ {
+		if payments[i-1].Amount < payments[i].Amount {
+			t.Errorf("FilterPaymentsSorted(): wrong order = %v", payments)
+		}
+	}
+
+	payments, err = s.FilterPaymentsSorted(1, OrderCategory, 4)
+	if err != nil || payments[0].Category != "auto" || payments[0].Amount != 1 || payments[1].Amount != 4 {
+		t.Errorf("FilterPaymentsSorted(): category order must be stable = %v, error = %v", payments, err)
+	}
+
+	_, err = s.FilterPaymentsSorted(1, "date", 4)
+	if !errors.Is(err, ErrInvalidOrder) || KindOf(err) != KindValidation {
+		t.Errorf("FilterPaymentsSorted(): must return ErrInvalidOrder, returned = %v", err)
+	}
+}
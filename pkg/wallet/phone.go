@@ -0,0 +1,55 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone converts phone to E.164 format, it accepts spaces, dashes,
+// dots and parentheses as separators and 00 instead of leading +
+func NormalizePhone(phone types.Phone) (types.Phone, error) {
+	value := strings.TrimSpace(string(phone))
+	value = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(value)
+	if strings.HasPrefix(value, "00") {
+		value = "+" + value[2:]
+	}
+
+	if !strings.HasPrefix(value, "+") {
+		return "", fmt.Errorf("%w: %q must start with + and country code", ErrInvalidPhone, phone)
+	}
+	digits := value[1:]
+	if len(digits) < 8 || len(digits) > 15 {
+		return "", fmt.Errorf("%w: %q must have from 8 to 15 digits", ErrInvalidPhone, phone)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q contains %q", ErrInvalidPhone, phone, r)
+		}
+	}
+	if digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q country code can not start with 0", ErrInvalidPhone, phone)
+	}
+	return types.Phone(value), nil
+}
+
+// FindAccountByPhone find account by phone in any format accepted by NormalizePhone
+func (s *Service) FindAccountByPhone(phone types.Phone) (account *types.Account, err error) {
+	defer wrapError(&err, "FindAccountByPhone", 0, "")
+
+	normalized, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range s.accounts {
+		if account.Phone == normalized {
+			return account, nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
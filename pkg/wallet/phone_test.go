@@ -0,0 +1,71 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone types.Phone
+		want  types.Phone
+		err   error
+	}{
+		{phone: "+992938638676", want: "+992938638676"},
+		{phone: "+992 93 863 8676", want: "+992938638676"},
+		{phone: "00992 (93) 863-86-76", want: "+992938638676"},
+		{phone: "992938638676", err: ErrInvalidPhone},
+		{phone: "+992 93 863 867a", err: ErrInvalidPhone},
+		{phone: "+0992938638676", err: ErrInvalidPhone},
+		{phone: "+1234", err: ErrInvalidPhone},
+	}
+	for _, test := range tests {
+		got, err := NormalizePhone(test.phone)
+		if !errors.Is(err, test.err) {
+			t.Errorf("NormalizePhone(%q): want error = %v, got = %v", test.phone, test.err, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("NormalizePhone(%q): want = %v, got = %v", test.phone, test.want, got)
+		}
+	}
+}
+
+func TestService_RegisterAccount_normalizedDuplicate(t *testing.T) {
+	s := newTestService()
+	_, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Errorf("RegisterAccount(): error = %v", err)
+		return
+	}
+
+	_, err = s.RegisterAccount("+992 93 863 8676")
+	if !errors.Is(err, ErrPhoneRegistered) {
+		t.Errorf("RegisterAccount(): must return ErrPhoneRegistered, returned = %v", err)
+	}
+}
+
+func TestService_FindAccountByPhone_success(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992 93 863 8676")
+	if err != nil {
+		t.Errorf("RegisterAccount(): error = %v", err)
+		return
+	}
+
+	got, err := s.FindAccountByPhone("00992938638676")
+	if err != nil {
+		t.Errorf("FindAccountByPhone(): error = %v", err)
+		return
+	}
+	if got != account {
+		t.Errorf("FindAccountByPhone(): want = %v, got = %v", account, got)
+	}
+
+	_, err = s.FindAccountByPhone("+992938638677")
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("FindAccountByPhone(): must return ErrAccountNotFound, returned = %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// paymentsPerPart is size of a part of SumPaymentsWithProgress
+const paymentsPerPart = 1_000_000
+
+// SumPaymentsWithProgress sums payments by parts of paymentsPerPart, the channel
+// gets result of every part and then the total with Final set
+func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
+	return s.SumPaymentsWithProgressContext(context.Background())
+}
+
+// SumPaymentsWithProgressContext sums like SumPaymentsWithProgress, when ctx
+// is done goroutines stop and the channel is closed without the rest of results
+func (s *Service) SumPaymentsWithProgressContext(ctx context.Context) <-chan types.Progress {
+	parts := (len(s.payments) + paymentsPerPart - 1) / paymentsPerPart
+	return s.AggregateWithProgressContext(ctx, sumJob(nil), parts)
+}
+
+// AggregateWithProgress runs job over payments in parts goroutines and reports progress
+func (s *Service) AggregateWithProgress(job Job, parts int) <-chan types.Progress {
+	return s.AggregateWithProgressContext(context.Background(), job, parts)
+}
+
+// AggregateWithProgressContext runs job by MapReduceContext over a copy of
+// payments, so the service can be changed while it runs. The channel gets
+// Progress of each part as it is done, with Processed payments of all done
+// parts, and then the result of job with Final set. Results of parts are sent
+// as they are, so Merge of job must not change them. When ctx is done the
+// channel is closed without the rest of results
+func (s *Service) AggregateWithProgressContext(ctx context.Context, job Job, parts int) <-chan types.Progress {
+	payments := make([]*types.Payment, len(s.payments))
+	for i, payment := range s.payments {
+		copied := *payment
+		payments[i] = &copied
+	}
+	snapshot := &Service{payments: payments}
+	total := len(payments)
+	parts = chunkCount(parts, total)
+
+	done := make(chan types.Progress)
+	job.Progress = func(chunk int, payments int, result interface{}) {
+		select {
+		case done <- types.Progress{Part: chunk, Processed: payments, Value: result}:
+		case <-ctx.Done():
+		}
+	}
+	final := make(chan interface{}, 1)
+	go func() {
+		defer close(done)
+		result, err := snapshot.MapReduceContext(ctx, job, parts)
+		if err == nil {
+			final <- result
+		}
+	}()
+
+	channel := make(chan types.Progress)
+	go func() {
+		defer close(channel)
+		processed := 0
+		for progress := range done {
+			processed += progress.Processed
+			progress.Processed = processed
+			progress.Total = total
+			if !sendProgress(ctx, channel, progress) {
+				return
+			}
+		}
+		select {
+		case result := <-final:
+			sendProgress(ctx, channel, types.Progress{Part: parts, Processed: total, Total: total, Value: result, Final: true})
+		default:
+		}
+	}()
+	return channel
+}
+
+// sendProgress sends progress unless ctx is done, Result is set when value is types.Money
+func sendProgress(ctx context.Context, channel chan<- types.Progress, progress types.Progress) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if money, ok := progress.Value.(types.Money); ok {
+		progress.Result = money
+	}
+	select {
+	case channel <- progress:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,122 @@
+package wallet
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func newProgressTestService(t *testing.T, count int) *Service {
+	s := &Service{}
+	account, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 1_000_000_00); err != nil {
+		t.Fatal(err)
+	}
+	categories := []types.PaymentCategory{"auto", "food", "cat"}
+	for i := 0; i < count; i++ {
+		_, err := s.Pay(account.ID, types.Money(i+1), categories[i%len(categories)])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestService_AggregateWithProgress(t *testing.T) {
+	s := newProgressTestService(t, 10)
+
+	// categories sums by category into new maps, so results of parts do not change
+	categories := Job{
+		Map: func(payment types.Payment) interface{} {
+			return map[types.PaymentCategory]types.Money{payment.Category: payment.Amount}
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			sums := map[types.PaymentCategory]types.Money{}
+			for _, part := range []interface{}{result, value} {
+				amounts, _ := part.(map[types.PaymentCategory]types.Money)
+				for category, amount := range amounts {
+					sums[category] += amount
+				}
+			}
+			return sums
+		},
+	}
+
+	tests := []struct {
+		job  Job
+		want interface{}
+	}{
+		{sumJob(nil), types.Money(55)},
+		{countJob(nil), 10},
+		{categories, map[types.PaymentCategory]types.Money{"auto": 22, "food": 15, "cat": 18}},
+	}
+	for _, test := range tests {
+		for _, parts := range []int{0, 1, 3, 10, 20} {
+			seen := map[int]bool{}
+			processed := 0
+			var final *types.Progress
+			for progress := range s.AggregateWithProgress(test.job, parts) {
+				progress := progress
+				if final != nil {
+					t.Errorf("AggregateWithProgress(%v): progress after final = %+v", parts, progress)
+				}
+				if progress.Final {
+					final = &progress
+					continue
+				}
+				if seen[progress.Part] || progress.Processed <= processed || progress.Total != 10 {
+					t.Errorf("AggregateWithProgress(%v): wrong progress = %+v", parts, progress)
+				}
+				seen[progress.Part] = true
+				processed = progress.Processed
+			}
+			if final == nil || processed != 10 || !reflect.DeepEqual(final.Value, test.want) {
+				t.Errorf("AggregateWithProgress(%v): final = %+v, processed = %v, want = %v", parts, final, processed, test.want)
+			}
+		}
+	}
+}
+
+func TestService_SumPaymentsWithProgress(t *testing.T) {
+	s := newProgressTestService(t, 5)
+
+	var results []types.Progress
+	for progress := range s.SumPaymentsWithProgress() {
+		results = append(results, progress)
+	}
+	if len(results) != 2 || results[0].Result != 15 || !results[1].Final || results[1].Result != 15 {
+		t.Errorf("SumPaymentsWithProgress(): wrong results = %+v", results)
+	}
+
+	empty := &Service{}
+	results = nil
+	for progress := range empty.SumPaymentsWithProgress() {
+		results = append(results, progress)
+	}
+	if len(results) != 2 || !results[1].Final || results[1].Result != 0 || results[1].Total != 0 {
+		t.Errorf("SumPaymentsWithProgress(): wrong results of empty service = %+v", results)
+	}
+}
+
+func TestService_AggregateWithProgressContext_canceled(t *testing.T) {
+	s := newProgressTestService(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := 0
+	for progress := range s.AggregateWithProgressContext(ctx, countJob(nil), 5) {
+		results++
+		if progress.Final {
+			t.Errorf("AggregateWithProgressContext(): must not send final after cancel")
+		}
+		cancel()
+	}
+	if results != 1 {
+		t.Errorf("AggregateWithProgressContext(): wrong results = %v", results)
+	}
+}
@@ -0,0 +1,352 @@
+package wallet
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidQuery = errors.New("invalid payment query")
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// DefaultPageSize is used when query has no limit, limit above MaxPageSize is lowered to it
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// PaymentQuery selects payments, empty fields do not filter. Payments of
+// any of AccountIDs, Categories, Statuses and FavoriteIDs are selected,
+// amount range and time range From..To include From and exclude To.
+// FromFavorite selects payments made or not made from favorites and Text
+// is found in ID, category, status or favorite name ignoring case.
+// Payments are sorted by Order and Cursor is NextCursor of the previous page
+type PaymentQuery struct {
+	AccountIDs   []int64                 `json:"account_ids,omitempty"`
+	Categories   []types.PaymentCategory `json:"categories,omitempty"`
+	Statuses     []types.PaymentStatus   `json:"statuses,omitempty"`
+	MinAmount    types.Money             `json:"min_amount,omitempty"`
+	MaxAmount    types.Money             `json:"max_amount,omitempty"`
+	From         time.Time               `json:"from,omitempty"`
+	To           time.Time               `json:"to,omitempty"`
+	FavoriteIDs  []string                `json:"favorite_ids,omitempty"`
+	FromFavorite *bool                   `json:"from_favorite,omitempty"`
+	Text         string                  `json:"text,omitempty"`
+	Order        PaymentOrder            `json:"order,omitempty"`
+	Limit        int                     `json:"limit,omitempty"`
+	Cursor       string                  `json:"cursor,omitempty"`
+}
+
+// PaymentPage is a page of payments, NextCursor is empty on the last page
+type PaymentPage struct {
+	Payments   []types.Payment `json:"payments"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// paymentIndex keeps positions of payments in s.payments by account,
+// category, favorite and merchant, payments are indexed before each query
+type paymentIndex struct {
+	indexed    int
+	byAccount  map[int64][]int
+	byCategory map[types.PaymentCategory][]int
+	byFavorite map[string][]int
+	byMerchant map[string][]int
+}
+
+// updatePaymentIndex indexes payments added after the last query
+func (s *Service) updatePaymentIndex() *paymentIndex {
+	if s.paymentIndex == nil || s.paymentIndex.indexed > len(s.payments) {
+		s.paymentIndex = &paymentIndex{
+			byAccount:  map[int64][]int{},
+			byCategory: map[types.PaymentCategory][]int{},
+			byFavorite: map[string][]int{},
+			byMerchant: map[string][]int{},
+		}
+	}
+	index := s.paymentIndex
+	for i := index.indexed; i < len(s.payments); i++ {
+		payment := s.payments[i]
+		index.byAccount[payment.AccountID] = append(index.byAccount[payment.AccountID], i)
+		index.byCategory[payment.Category] = append(index.byCategory[payment.Category], i)
+		if payment.FavoriteID != "" {
+			index.byFavorite[payment.FavoriteID] = append(index.byFavorite[payment.FavoriteID], i)
+		}
+		if payment.MerchantID != "" {
+			index.byMerchant[payment.MerchantID] = append(index.byMerchant[payment.MerchantID], i)
+		}
+	}
+	index.indexed = len(s.payments)
+	return index
+}
+
+// QueryPayments returns a page of payments selected by query
+func (s *Service) QueryPayments(query PaymentQuery) (PaymentPage, error) {
+	return s.QueryPaymentsContext(context.Background(), query)
+}
+
+// QueryPaymentsContext runs query like QueryPayments, it stops when ctx is done
+func (s *Service) QueryPaymentsContext(ctx context.Context, query PaymentQuery) (page PaymentPage, err error) {
+	defer wrapError(&err, "QueryPayments", 0, "")
+
+	less, err := lessOf(query.Order)
+	if err != nil {
+		return page, err
+	}
+	if err = query.validate(); err != nil {
+		return page, err
+	}
+	cursor, err := decodeCursor(query.Cursor, query.Order, len(s.payments))
+	if err != nil {
+		return page, err
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var favoriteNames map[string]string
+	if query.Text != "" {
+		favoriteNames = make(map[string]string, len(s.favorites))
+		for _, favorite := range s.favorites {
+			favoriteNames[favorite.ID] = favorite.Name
+		}
+	}
+	matched := []int{}
+	for j, i := range s.paymentCandidates(query) {
+		if canceled(ctx, j) {
+			return page, ctx.Err()
+		}
+		if query.match(*s.payments[i], favoriteNames) {
+			matched = append(matched, i)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(matched, func(a, b int) bool {
+			return less(*s.payments[matched[a]], *s.payments[matched[b]])
+		})
+	}
+
+	start := 0
+	if cursor >= 0 {
+		pivot := *s.payments[cursor]
+		start = sort.Search(len(matched), func(k int) bool {
+			i := matched[k]
+			if less == nil {
+				return i > cursor
+			}
+			payment := *s.payments[i]
+			return less(pivot, payment) || !less(payment, pivot) && i > cursor
+		})
+	}
+	end := start + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	page.Payments = make([]types.Payment, 0, end-start)
+	for _, i := range matched[start:end] {
+		page.Payments = append(page.Payments, *s.payments[i])
+	}
+	if end < len(matched) {
+		page.NextCursor = encodeCursor(query.Order, matched[end-1])
+	}
+	return page, nil
+}
+
+// paymentCandidates returns positions of payments which may match query in
+// ascending order, the smallest set of indexed fields of query is used
+func (s *Service) paymentCandidates(query PaymentQuery) []int {
+	index := s.updatePaymentIndex()
+
+	var lists [][][]int
+	if len(query.AccountIDs) > 0 {
+		seen := map[int64]bool{}
+		var set [][]int
+		for _, accountID := range query.AccountIDs {
+			if !seen[accountID] {
+				seen[accountID] = true
+				set = append(set, index.byAccount[accountID])
+			}
+		}
+		lists = append(lists, set)
+	}
+	if len(query.Categories) > 0 {
+		seen := map[types.PaymentCategory]bool{}
+		var set [][]int
+		for _, category := range query.Categories {
+			if !seen[category] {
+				seen[category] = true
+				set = append(set, index.byCategory[category])
+			}
+		}
+		lists = append(lists, set)
+	}
+	if len(query.FavoriteIDs) > 0 {
+		seen := map[string]bool{}
+		var set [][]int
+		for _, favoriteID := range query.FavoriteIDs {
+			if !seen[favoriteID] {
+				seen[favoriteID] = true
+				set = append(set, index.byFavorite[favoriteID])
+			}
+		}
+		lists = append(lists, set)
+	}
+
+	if len(lists) == 0 {
+		all := make([]int, len(s.payments))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	best, bestSize := 0, -1
+	for i, set := range lists {
+		size := 0
+		for _, positions := range set {
+			size += len(positions)
+		}
+		if bestSize < 0 || size < bestSize {
+			best, bestSize = i, size
+		}
+	}
+	candidates := make([]int, 0, bestSize)
+	for _, positions := range lists[best] {
+		candidates = append(candidates, positions...)
+	}
+	if len(lists[best]) > 1 {
+		sort.Ints(candidates)
+	}
+	return candidates
+}
+
+// validate checks ranges and limit of query
+func (q PaymentQuery) validate() error {
+	switch {
+	case q.MinAmount < 0 || q.MaxAmount < 0:
+		return fmt.Errorf("%w: amounts must not be negative", ErrInvalidQuery)
+	case q.MaxAmount != 0 && q.MinAmount > q.MaxAmount:
+		return fmt.Errorf("%w: min_amount is above max_amount", ErrInvalidQuery)
+	case !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From):
+		return fmt.Errorf("%w: to is before from", ErrInvalidQuery)
+	case q.Limit < 0:
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// match checks every field of query, favoriteNames are needed when Text is set
+func (q PaymentQuery) match(payment types.Payment, favoriteNames map[string]string) bool {
+	if len(q.AccountIDs) > 0 && !containsAccount(q.AccountIDs, payment.AccountID) {
+		return false
+	}
+	if len(q.Categories) > 0 && !containsCategory(q.Categories, payment.Category) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsStatus(q.Statuses, payment.Status) {
+		return false
+	}
+	if len(q.FavoriteIDs) > 0 && !containsString(q.FavoriteIDs, payment.FavoriteID) {
+		return false
+	}
+	if q.FromFavorite != nil && *q.FromFavorite != (payment.FavoriteID != "") {
+		return false
+	}
+	if payment.Amount < q.MinAmount || q.MaxAmount != 0 && payment.Amount > q.MaxAmount {
+		return false
+	}
+	if !q.From.IsZero() && payment.CreatedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !payment.CreatedAt.Before(q.To) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		fields := []string{payment.ID, string(payment.Category), string(payment.Status), favoriteNames[payment.FavoriteID]}
+		found := false
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAccount(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCategory(values []types.PaymentCategory, value types.PaymentCategory) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(values []types.PaymentStatus, value types.PaymentStatus) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCursor makes cursor of page ending at payment of position, the order
+// is kept in cursor so it is not used with another order
+func encodeCursor(order PaymentOrder, position int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(string(order) + ":" + strconv.Itoa(position)))
+}
+
+// decodeCursor returns position of cursor or -1 for empty cursor
+func decodeCursor(cursor string, order PaymentOrder, payments int) (int, error) {
+	if cursor == "" {
+		return -1, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	separator := strings.LastIndex(string(data), ":")
+	if separator < 0 || PaymentOrder(data[:separator]) != order {
+		return 0, ErrInvalidCursor
+	}
+	position, err := strconv.Atoi(string(data[separator+1:]))
+	if err != nil || position < 0 || position >= payments {
+		return 0, ErrInvalidCursor
+	}
+	return position, nil
+}
@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+// newQueryTestService makes payments of two accounts one hour apart starting at start
+func newQueryTestService(t *testing.T, start time.Time) (*Service, *types.Favorite) {
+	s := &Service{}
+	now := start
+	s.SetClock(func() time.Time { return now })
+
+	categories := []types.PaymentCategory{"auto", "food", "cat"}
+	for _, phone := range []types.Phone{"+992938638676", "+992938638677"} {
+		account, err := s.RegisterAccount(phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Deposit(account.ID, 1_000_000_00); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 9; i++ {
+			if _, err := s.Pay(account.ID, types.Money(100*(i%4+1)), categories[i%3]); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(time.Hour)
+		}
+	}
+	favorite, err := s.FavoritePayment(s.payments[0].ID, "Car Wash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PayFromFavorite(favorite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject(s.payments[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	return s, favorite
+}
+
+// serialQuery selects payments by query without indexes and pages
+func serialQuery(s *Service, query PaymentQuery) []types.Payment {
+	names := map[string]string{}
+	for _, favorite := range s.favorites {
+		names[favorite.ID] = favorite.Name
+	}
+	payments := []types.Payment{}
+	for _, payment := range s.payments {
+		if query.match(*payment, names) {
+			payments = append(payments, *payment)
+		}
+	}
+	SortPayments(payments, query.Order)
+	return payments
+}
+
+func TestService_QueryPayments_filters(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, favorite := newQueryTestService(t, start)
+	fromFavorite := true
+
+	tests := []struct {
+		query PaymentQuery
+		count int
+	}{
+		{PaymentQuery{}, 19},
+		{PaymentQuery{AccountIDs: []int64{2}}, 9},
+		{PaymentQuery{AccountIDs: []int64{1, 2, 1}, Categories: []types.PaymentCategory{"cat"}}, 6},
+		{PaymentQuery{Statuses: []types.PaymentStatus{types.PaymentStatusFail}}, 1},
+		{PaymentQuery{MinAmount: 300, MaxAmount: 400}, 8},
+		{PaymentQuery{From: start.Add(2 * time.Hour), To: start.Add(5 * time.Hour)}, 3},
+		{PaymentQuery{FavoriteIDs: []string{favorite.ID}}, 1},
+		{PaymentQuery{FromFavorite: &fromFavorite}, 1},
+		{PaymentQuery{Text: "car wash"}, 1},
+		{PaymentQuery{Text: "FOO"}, 6},
+		{PaymentQuery{AccountIDs: []int64{3}}, 0},
+	}
+	for _, test := range tests {
+		page, err := s.QueryPayments(test.query)
+		if err != nil || len(page.Payments) != test.count || page.NextCursor != "" {
+			t.Errorf("QueryPayments(%+v): count = %v, want %v, error = %v", test.query, len(page.Payments), test.count, err)
+			continue
+		}
+		if want := serialQuery(s, test.query); !reflect.DeepEqual(page.Payments, want) {
+			t.Errorf("QueryPayments(%+v): wrong payments", test.query)
+		}
+	}
+}
+
+func TestService_QueryPayments_pages(t *testing.T) {
+	s, _ := newQueryTestService(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	orders := []PaymentOrder{OrderInserted, OrderAmount, OrderAmountDesc, OrderCategory, "-category", OrderCreatedDesc}
+	for _, order := range orders {
+		query := PaymentQuery{Categories: []types.PaymentCategory{"auto", "food"}, Order: order, Limit: 4}
+		got := []types.Payment{}
+		for pages := 0; pages < 10; pages++ {
+			page, err := s.QueryPayments(query)
+			if err != nil {
+				t.Errorf("QueryPayments(%v): error = %v", order, err)
+				break
+			}
+			got = append(got, page.Payments...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		query.Cursor = ""
+		if want := serialQuery(s, query); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryPayments(%v): pages = %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestService_QueryPayments_invalid(t *testing.T) {
+	s, _ := newQueryTestService(t, time.Now())
+
+	page, err := s.QueryPayments(PaymentQuery{Order: OrderAmount, Limit: 1})
+	if err != nil {
+		t.Errorf("QueryPayments(): error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		query PaymentQuery
+		err   error
+	}{
+		{PaymentQuery{MinAmount: 10, MaxAmount: 5}, ErrInvalidQuery},
+		{PaymentQuery{Limit: -1}, ErrInvalidQuery},
+		{PaymentQuery{From: time.Now(), To: time.Now().Add(-time.Hour)}, ErrInvalidQuery},
+		{PaymentQuery{Order: "date"}, ErrInvalidOrder},
+		{PaymentQuery{Cursor: "x"}, ErrInvalidCursor},
+		{PaymentQuery{Cursor: page.NextCursor}, ErrInvalidCursor},
+	}
+	for _, test := range tests {
+		_, err := s.QueryPayments(test.query)
+		if !errors.Is(err, test.err) || KindOf(err) != KindValidation {
+			t.Errorf("QueryPayments(%+v): must return %v, returned = %v", test.query, test.err, err)
+		}
+	}
+}
+
+func TestService_QueryPayments_index(t *testing.T) {
+	s, _ := newQueryTestService(t, time.Now())
+	query := PaymentQuery{AccountIDs: []int64{1}, Categories: []types.PaymentCategory{"cat"}}
+
+	page, err := s.QueryPayments(query)
+	if err != nil || len(page.Payments) != 3 {
+		t.Errorf("QueryPayments(): payments = %v, error = %v", page.Payments, err)
+	}
+	if _, err := s.Pay(1, 100, "cat"); err != nil {
+		t.Fatal(err)
+	}
+	page, err = s.QueryPayments(query)
+	if err != nil || len(page.Payments) != 4 {
+		t.Errorf("QueryPayments(): new payment must be indexed, payments = %v, error = %v", page.Payments, err)
+	}
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !imported.payments[3].CreatedAt.Equal(s.payments[3].CreatedAt.Truncate(time.Second)) {
+		t.Errorf("Import(): wrong created time = %v", imported.payments[3].CreatedAt)
+	}
+}
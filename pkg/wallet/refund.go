@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrRefundExceedsPayment = errors.New("refund exceeds payment amount")
+var ErrPaymentNotRefundable = errors.New("payment can not be refunded")
+
+// Refund returns amount of the payment to the account, it can be called
+// several times until the whole payment is refunded
+func (s *Service) Refund(paymentID string, amount types.Money) (refund *types.Refund, err error) {
+	defer wrapError(&err, "Refund", s.accountOfPayment(paymentID), paymentID)
+	defer s.startAudit("Refund", s.accountOfPayment(paymentID), 0, paymentID, amount).finish(&err)
+
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	payment, err := s.FindPaymentByID(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status == types.PaymentStatusFail || payment.Status == types.PaymentStatusRefunded {
+		return nil, ErrPaymentNotRefundable
+	}
+
+	refunded := s.refundedAmount(payment.ID)
+	if refunded+amount > payment.Amount {
+		return nil, ErrRefundExceedsPayment
+	}
+
+	account, err := s.FindAccountByID(payment.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if account, err = s.creditedAccount(account); err != nil {
+		return nil, err
+	}
+
+	refund = &types.Refund{
+		ID:        uuid.New().String(),
+		PaymentID: payment.ID,
+		AccountID: account.ID,
+		Amount:    amount,
+	}
+	s.refunds = append(s.refunds, refund)
+	account.Balance += amount
+	s.debitMerchant(payment, amount)
+
+	if refunded+amount == payment.Amount {
+		payment.Status = types.PaymentStatusRefunded
+	} else {
+		payment.Status = types.PaymentStatusPartiallyRefunded
+	}
+	return refund, nil
+}
+
+// RefundsByPayment returns refunds of the payment
+func (s *Service) RefundsByPayment(paymentID string) []types.Refund {
+	var refunds []types.Refund
+	for _, refund := range s.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds
+}
+
+func (s *Service) refundedAmount(paymentID string) types.Money {
+	sum := types.Money(0)
+	for _, refund := range s.refunds {
+		if refund.PaymentID == paymentID {
+			sum += refund.Amount
+		}
+	}
+	return sum
+}
+
+// refundRecords converts refunds to dump records
+func (s *Service) refundRecords() [][]string {
+	records := make([][]string, 0, len(s.refunds))
+	for _, refund := range s.refunds {
+		records = append(records, []string{
+			fmt.Sprint(refund.ID),
+			fmt.Sprint(refund.PaymentID),
+			fmt.Sprint(refund.AccountID),
+			fmt.Sprint(refund.Amount),
+		})
+	}
+	return records
+}
+
+// importRefunds restores refunds from dump records
+func (s *Service) importRefunds(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 4 {
+			return fmt.Errorf("refund record has %d fields", len(record))
+		}
+		accountID, err := strconv.Atoi(record[2])
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.Atoi(record[3])
+		if err != nil {
+			return err
+		}
+
+		s.refunds = append(s.refunds, &types.Refund{
+			ID:        record[0],
+			PaymentID: record[1],
+			AccountID: int64(accountID),
+			Amount:    types.Money(amount),
+		})
+		s.log().Debug("refund imported", "account_id", accountID, "payment_id", record[1], "refund_id", record[0])
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_Refund_partial(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	payment := payments[0]
+
+	_, err = s.Refund(payment.ID, 400_00)
+	if err != nil {
+		t.Errorf("Refund(): error = %v", err)
+		return
+	}
+	if payment.Status != types.PaymentStatusPartiallyRefunded {
+		t.Errorf("Refund(): wrong status = %v", payment.Status)
+	}
+
+	_, err = s.Refund(payment.ID, 600_00)
+	if err != nil {
+		t.Errorf("Refund(): error = %v", err)
+		return
+	}
+	if payment.Status != types.PaymentStatusRefunded {
+		t.Errorf("Refund(): wrong status = %v", payment.Status)
+	}
+	if account.Balance != defaultTestAccount.balance {
+		t.Errorf("Refund(): wrong balance = %v", account.Balance)
+	}
+	if len(s.RefundsByPayment(payment.ID)) != 2 {
+		t.Errorf("RefundsByPayment(): wrong count = %v", len(s.RefundsByPayment(payment.ID)))
+	}
+}
+
+func TestService_Refund_exceedsPayment(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	payment := payments[0]
+
+	_, err = s.Refund(payment.ID, 700_00)
+	if err != nil {
+		t.Errorf("Refund(): error = %v", err)
+		return
+	}
+
+	_, err = s.Refund(payment.ID, 300_01)
+	if !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Errorf("Refund(): must return ErrRefundExceedsPayment, returned = %v", err)
+	}
+}
+
+func TestService_Reject_afterRefund(t *testing.T) {
+	s := newTestService()
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	payment := payments[0]
+
+	_, err = s.Refund(payment.ID, 300_00)
+	if err != nil {
+		t.Errorf("Refund(): error = %v", err)
+		return
+	}
+
+	err = s.Reject(payment.ID)
+	if err != nil {
+		t.Errorf("Reject(): error = %v", err)
+		return
+	}
+	if account.Balance != defaultTestAccount.balance {
+		t.Errorf("Reject(): wrong balance = %v", account.Balance)
+	}
+}
+
+func TestService_Refund_exportImport(t *testing.T) {
+	s := newTestService()
+	_, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	payment := payments[0]
+
+	_, err = s.Refund(payment.ID, 300_00)
+	if err != nil {
+		t.Errorf("Refund(): error = %v", err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = s.Export(dir)
+	if err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+
+	svc := &Service{}
+	err = svc.Import(dir)
+	if err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+
+	_, err = svc.Refund(payment.ID, 700_01)
+	if !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Errorf("Refund(): must return ErrRefundExceedsPayment, returned = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package wallet
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrInvalidReport = errors.New("invalid report")
+
+// ReportOptions of SpendingReport, periods are split in Location, nil Location is UTC
+type ReportOptions struct {
+	Period     types.ReportPeriod
+	From       time.Time
+	To         time.Time
+	Location   *time.Location
+	Goroutines int
+}
+
+// reportKey is a row of report
+type reportKey struct {
+	period   string
+	category types.PaymentCategory
+}
+
+// reportItem is the amount of payment in its row
+type reportItem struct {
+	key    reportKey
+	amount types.Money
+}
+
+// SpendingReport groups payments of account by category and by period of
+// options. Failed payments are skipped and refunds are taken off amounts
+func (s *Service) SpendingReport(accountID int64, options ReportOptions) (types.Report, error) {
+	return s.SpendingReportContext(context.Background(), accountID, options)
+}
+
+// SpendingReportContext makes report like SpendingReport, goroutines exit when ctx is done
+func (s *Service) SpendingReportContext(ctx context.Context, accountID int64, options ReportOptions) (report types.Report, err error) {
+	defer wrapError(&err, "SpendingReport", accountID, "")
+
+	periodOf, err := reportPeriod(options.Period)
+	if err != nil {
+		return report, err
+	}
+	if !options.From.IsZero() && !options.To.IsZero() && options.To.Before(options.From) {
+		return report, fmt.Errorf("%w: to is before from", ErrInvalidReport)
+	}
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return report, err
+	}
+	location := options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	refunded := map[string]types.Money{}
+	for _, refund := range s.refunds {
+		refunded[refund.PaymentID] += refund.Amount
+	}
+	result, err := s.MapReduceContext(ctx, Job{
+		Filter: func(payment types.Payment) bool {
+			return payment.AccountID == accountID &&
+				payment.Status != types.PaymentStatusFail &&
+				payment.Amount > refunded[payment.ID] &&
+				(options.From.IsZero() || !payment.CreatedAt.Before(options.From)) &&
+				(options.To.IsZero() || payment.CreatedAt.Before(options.To))
+		},
+		Map: func(payment types.Payment) interface{} {
+			return reportItem{
+				key:    reportKey{period: periodOf(payment.CreatedAt.In(location)), category: payment.Category},
+				amount: payment.Amount - refunded[payment.ID],
+			}
+		},
+		Reduce: func(result interface{}, value interface{}) interface{} {
+			rows, ok := result.(map[reportKey]types.ReportRow)
+			if !ok {
+				rows = map[reportKey]types.ReportRow{}
+			}
+			item := value.(reportItem)
+			row := rows[item.key]
+			row.Total += item.amount
+			row.Count++
+			rows[item.key] = row
+			return rows
+		},
+		Merge: func(result interface{}, part interface{}) interface{} {
+			rows := result.(map[reportKey]types.ReportRow)
+			for key, partRow := range part.(map[reportKey]types.ReportRow) {
+				row := rows[key]
+				row.Total += partRow.Total
+				row.Count += partRow.Count
+				rows[key] = row
+			}
+			return rows
+		},
+	}, options.Goroutines)
+	if err != nil {
+		return report, err
+	}
+
+	report = types.Report{
+		AccountID: accountID,
+		Period:    options.Period,
+		From:      options.From,
+		To:        options.To,
+		Rows:      []types.ReportRow{},
+	}
+	rows, _ := result.(map[reportKey]types.ReportRow)
+	periodTotals := map[string]types.Money{}
+	for key, row := range rows {
+		row.Period = key.period
+		row.Category = key.category
+		report.Rows = append(report.Rows, row)
+		report.Total += row.Total
+		report.Count += row.Count
+		periodTotals[key.period] += row.Total
+	}
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		row.Share = float64(row.Total) / float64(periodTotals[row.Period])
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Category < b.Category
+	})
+	return report, nil
+}
+
+// reportPeriod returns name of period of time, names sort in time order
+func reportPeriod(period types.ReportPeriod) (func(t time.Time) string, error) {
+	switch period {
+	case types.ReportPeriodNone:
+		return func(t time.Time) string { return "" }, nil
+	case types.ReportPeriodDay:
+		return func(t time.Time) string { return t.Format("2006-01-02") }, nil
+	case types.ReportPeriodWeek:
+		return func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", year, week)
+		}, nil
+	case types.ReportPeriodMonth:
+		return func(t time.Time) string { return t.Format("2006-01") }, nil
+	}
+	return nil, fmt.Errorf("%w: unknown period %q", ErrInvalidReport, period)
+}
+
+// WriteReportCSV writes rows of report with header period,category,total,count,share
+func WriteReportCSV(w io.Writer, report types.Report) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"period", "category", "total", "count", "share"})
+	for _, row := range report.Rows {
+		writer.Write([]string{
+			row.Period,
+			string(row.Category),
+			strconv.FormatInt(int64(row.Total), 10),
+			strconv.Itoa(row.Count),
+			strconv.FormatFloat(row.Share, 'f', 4, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteReportJSON writes report as indented JSON
+func WriteReportJSON(w io.Writer, report types.Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// ExportReport writes report to file, the format is chosen by .csv or .json extension
+func ExportReport(report types.Report, path string) (err error) {
+	defer wrapError(&err, "ExportReport", report.AccountID, "")
+
+	write := WriteReportJSON
+	switch filepath.Ext(path) {
+	case ".csv":
+		write = WriteReportCSV
+	case ".json":
+	default:
+		return fmt.Errorf("%w: file %s must be .csv or .json", ErrInvalidReport, path)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return ioError(err)
+	}
+	if err = write(file, report); err != nil {
+		file.Close()
+		return ioError(err)
+	}
+	if err = file.Close(); err != nil {
+		return ioError(err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func newReportTestService(t *testing.T) *Service {
+	s := &Service{}
+	now := time.Date(2020, 1, 30, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	account, err := s.RegisterAccount("+992938638676")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Deposit(account.ID, 1_000_000_00)
+
+	payments := []struct {
+		amount   types.Money
+		category types.PaymentCategory
+		days     int
+	}{
+		{300, "food", 0}, {100, "auto", 0}, {600, "food", 1}, {1000, "auto", 4}, {500, "cat", 4},
+	}
+	for _, payment := range payments {
+		now = time.Date(2020, 1, 30+payment.days, 12, 0, 0, 0, time.UTC)
+		if _, err := s.Pay(account.ID, payment.amount, payment.category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// rejected and partially refunded payments
+	if err := s.Reject(s.payments[4].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refund(s.payments[2].ID, 400); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := s.RegisterAccount("+992938638677")
+	s.Deposit(other.ID, 1000)
+	s.Pay(other.ID, 1000, "food")
+	return s
+}
+
+func TestService_SpendingReport(t *testing.T) {
+	s := newReportTestService(t)
+
+	report, err := s.SpendingReport(1, ReportOptions{})
+	if err != nil {
+		t.Errorf("SpendingReport(): error = %v", err)
+		return
+	}
+	want := []types.ReportRow{
+		{Category: "auto", Total: 1100, Count: 2, Share: 0.6875},
+		{Category: "food", Total: 500, Count: 2, Share: 0.3125},
+	}
+	if report.Total != 1600 || report.Count != 4 || !reflect.DeepEqual(report.Rows, want) {
+		t.Errorf("SpendingReport(): wrong report = %+v", report)
+	}
+
+	report, err = s.SpendingReport(1, ReportOptions{Period: types.ReportPeriodMonth, Goroutines: 3})
+	if err != nil || len(report.Rows) != 3 || report.Rows[0].Period != "2020-01" || report.Rows[2].Period != "2020-02" || report.Rows[2].Share != 1 {
+		t.Errorf("SpendingReport(month): rows = %+v, error = %v", report.Rows, err)
+	}
+
+	report, err = s.SpendingReport(1, ReportOptions{Period: types.ReportPeriodWeek})
+	if err != nil || len(report.Rows) != 3 || report.Rows[0].Period != "2020-W05" || report.Rows[2].Period != "2020-W06" {
+		t.Errorf("SpendingReport(week): rows = %+v, error = %v", report.Rows, err)
+	}
+
+	from := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	report, err = s.SpendingReport(1, ReportOptions{Period: types.ReportPeriodDay, From: from})
+	if err != nil || len(report.Rows) != 2 || report.Rows[0].Period != "2020-01-31" || report.Rows[1].Period != "2020-02-03" {
+		t.Errorf("SpendingReport(day): rows = %+v, error = %v", report.Rows, err)
+	}
+}
+
+func TestService_SpendingReport_parallel(t *testing.T) {
+	s := newProgressTestService(t, 200)
+
+	serial, err := s.SpendingReport(1, ReportOptions{Goroutines: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, goroutines := range goroutineCounts {
+		report, err := s.SpendingReport(1, ReportOptions{Goroutines: goroutines})
+		if err != nil || !reflect.DeepEqual(report, serial) {
+			t.Errorf("SpendingReport(%v): report = %+v, want %+v, error = %v", goroutines, report, serial, err)
+		}
+	}
+}
+
+func TestService_SpendingReport_errors(t *testing.T) {
+	s := newReportTestService(t)
+
+	_, err := s.SpendingReport(3, ReportOptions{})
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("SpendingReport(): must return ErrAccountNotFound, returned = %v", err)
+	}
+	_, err = s.SpendingReport(1, ReportOptions{Period: "year"})
+	if !errors.Is(err, ErrInvalidReport) || KindOf(err) != KindValidation {
+		t.Errorf("SpendingReport(): must return ErrInvalidReport, returned = %v", err)
+	}
+
+	account, _ := s.RegisterAccount("+992938638678")
+	report, err := s.SpendingReport(account.ID, ReportOptions{})
+	if err != nil || report.Rows == nil || len(report.Rows) != 0 || report.Total != 0 {
+		t.Errorf("SpendingReport(): must return empty report, report = %+v, error = %v", report, err)
+	}
+}
+
+func TestExportReport(t *testing.T) {
+	s := newReportTestService(t)
+	report, err := s.SpendingReport(1, ReportOptions{Period: types.ReportPeriodMonth})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteReportCSV(buf, report); err != nil {
+		t.Errorf("WriteReportCSV(): error = %v", err)
+	}
+	want := "period,category,total,count,share\n" +
+		"2020-01,food,500,2,0.8333\n" +
+		"2020-01,auto,100,1,0.1667\n" +
+		"2020-02,auto,1000,1,1.0000\n"
+	if buf.String() != want {
+		t.Errorf("WriteReportCSV(): wrong csv = %q", buf.String())
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if err := ExportReport(report, path); err != nil {
+		t.Errorf("ExportReport(): error = %v", err)
+		return
+	}
+	data, _ := ioutil.ReadFile(path)
+	read := types.Report{}
+	if err := json.Unmarshal(data, &read); err != nil || !reflect.DeepEqual(read.Rows, report.Rows) {
+		t.Errorf("ExportReport(): wrong json = %s, error = %v", data, err)
+	}
+
+	err = ExportReport(report, filepath.Join(dir, "report.txt"))
+	if !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("ExportReport(): must return ErrInvalidReport, returned = %v", err)
+	}
+	err = ExportReport(report, filepath.Join(dir, "missing", "report.csv"))
+	if err == nil || !strings.Contains(err.Error(), "ExportReport") {
+		t.Errorf("ExportReport(): must return error, returned = %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+const defaultScheduleRetries = 3
+const defaultScheduleBackoff = time.Hour
+
+// retryPolicy of the scheduled payments which failed with ErrNotEnoughBalance
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// SetScheduleRetry sets how many times and with which initial backoff
+// a scheduled payment is retried, the backoff doubles after every attempt
+func (s *Service) SetScheduleRetry(retries int, backoff time.Duration) {
+	s.scheduleRetry = &retryPolicy{retries: retries, backoff: backoff}
+}
+
+// ScheduleFavorite pays the favorite by schedule spec (@daily, @weekly, @monthly
+// or cron expression) starting from start, zero start means now. Schedules are
+// authorized when they are created and their runs need no credential, so
+// accounts with credential must use ScheduleFavoriteWithCredential for
+// amounts above the auth threshold
+func (s *Service) ScheduleFavorite(favoriteID string, spec string, start time.Time) (*types.Schedule, error) {
+	return s.scheduleFavorite(favoriteID, spec, start, nil)
+}
+
+// ScheduleFavoriteWithCredential schedules favorite confirmed by credential
+func (s *Service) ScheduleFavoriteWithCredential(favoriteID string, spec string, start time.Time, auth types.Credential) (schedule *types.Schedule, err error) {
+	defer wrapError(&err, "ScheduleFavoriteWithCredential", s.accountOfFavorite(favoriteID), "")
+
+	return s.scheduleFavorite(favoriteID, spec, start, &auth)
+}
+
+func (s *Service) scheduleFavorite(favoriteID string, spec string, start time.Time, auth *types.Credential) (schedule *types.Schedule, err error) {
+	defer wrapError(&err, "ScheduleFavorite", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("ScheduleFavorite", s.accountOfFavorite(favoriteID), 0, favoriteID, spec, start).finish(&err)
+
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.authorizeOperation(favorite.AccountID, auth, favorite.Amount > s.authThreshold); err != nil {
+		return nil, err
+	}
+	return s.addSchedule(&types.Schedule{
+		AccountID:  favorite.AccountID,
+		FavoriteID: favorite.ID,
+		Amount:     favorite.Amount,
+		Category:   favorite.Category,
+		Spec:       spec,
+	}, start)
+}
+
+// SchedulePayment pays amount in category by schedule spec starting from start,
+// accounts with credential must use SchedulePaymentWithCredential for amounts
+// above the auth threshold
+func (s *Service) SchedulePayment(accountID int64, amount types.Money, category types.PaymentCategory, spec string, start time.Time) (*types.Schedule, error) {
+	return s.schedulePayment(accountID, amount, category, spec, start, nil)
+}
+
+// SchedulePaymentWithCredential schedules payment confirmed by credential
+func (s *Service) SchedulePaymentWithCredential(accountID int64, amount types.Money, category types.PaymentCategory, spec string, start time.Time, auth types.Credential) (schedule *types.Schedule, err error) {
+	defer wrapError(&err, "SchedulePaymentWithCredential", accountID, "")
+
+	return s.schedulePayment(accountID, amount, category, spec, start, &auth)
+}
+
+func (s *Service) schedulePayment(accountID int64, amount types.Money, category types.PaymentCategory, spec string, start time.Time, auth *types.Credential) (schedule *types.Schedule, err error) {
+	defer wrapError(&err, "SchedulePayment", accountID, "")
+	defer s.startAudit("SchedulePayment", accountID, 0, amount, category, spec, start).finish(&err)
+
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+	if category, err = s.resolveCategory(category); err != nil {
+		return nil, err
+	}
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	if err = s.authorizeOperation(accountID, auth, amount > s.authThreshold); err != nil {
+		return nil, err
+	}
+	return s.addSchedule(&types.Schedule{
+		AccountID: accountID,
+		Amount:    amount,
+		Category:  category,
+		Spec:      spec,
+	}, start)
+}
+
+// FindScheduleByID find schedule by id
+func (s *Service) FindScheduleByID(scheduleID string) (found *types.Schedule, err error) {
+	defer wrapError(&err, "FindScheduleByID", 0, "")
+
+	for _, schedule := range s.schedules {
+		if schedule.ID == scheduleID {
+			return schedule, nil
+		}
+	}
+	return nil, ErrScheduleNotFound
+}
+
+// CancelSchedule stops the schedule, its runs stay in history
+func (s *Service) CancelSchedule(scheduleID string) (err error) {
+	defer wrapError(&err, "CancelSchedule", s.accountOfSchedule(scheduleID), "")
+	defer s.startAudit("CancelSchedule", s.accountOfSchedule(scheduleID), 0, scheduleID).finish(&err)
+
+	schedule, err := s.FindScheduleByID(scheduleID)
+	if err != nil {
+		return err
+	}
+	schedule.Active = false
+	return nil
+}
+
+// ScheduleRuns returns the history of schedule runs
+func (s *Service) ScheduleRuns(scheduleID string) []types.ScheduleRun {
+	var runs []types.ScheduleRun
+	for _, run := range s.scheduleRuns {
+		if run.ScheduleID == scheduleID {
+			runs = append(runs, *run)
+		}
+	}
+	return runs
+}
+
+// RunDueSchedules executes all schedules which are due by the service clock
+// and returns the outcome of every run
+func (s *Service) RunDueSchedules() []types.ScheduleRun {
+	return s.RunDueSchedulesContext(context.Background())
+}
+
+// RunDueSchedulesContext runs schedules like RunDueSchedules, schedules which
+// are not started when ctx is done stay due
+func (s *Service) RunDueSchedulesContext(ctx context.Context) []types.ScheduleRun {
+	now := s.currentTime()
+	policy := retryPolicy{retries: defaultScheduleRetries, backoff: defaultScheduleBackoff}
+	if s.scheduleRetry != nil {
+		policy = *s.scheduleRetry
+	}
+
+	var runs []types.ScheduleRun
+	for _, schedule := range s.schedules {
+		if ctx.Err() != nil {
+			break
+		}
+		if !schedule.Active {
+			continue
+		}
+		due := schedule.NextRun
+		if !schedule.RetryAt.IsZero() {
+			due = schedule.RetryAt
+		}
+		if due.After(now) {
+			continue
+		}
+
+		run := &types.ScheduleRun{ScheduleID: schedule.ID, Time: now}
+		payment, err := s.runSchedule(schedule)
+		switch {
+		case err == nil:
+			run.Status = types.ScheduleRunOk
+			run.PaymentID = payment.ID
+		case errors.Is(err, ErrNotEnoughBalance) && schedule.Attempts < policy.retries:
+			schedule.Attempts++
+			schedule.RetryAt = now.Add(policy.backoff << uint(schedule.Attempts-1))
+			run.Status = types.ScheduleRunRetry
+			run.Error = err.Error()
+		default:
+			run.Status = types.ScheduleRunFail
+			run.Error = err.Error()
+		}
+
+		if run.Status != types.ScheduleRunRetry {
+			schedule.Attempts = 0
+			schedule.RetryAt = time.Time{}
+			s.advanceSchedule(schedule, now)
+		}
+		s.scheduleRuns = append(s.scheduleRuns, run)
+		runs = append(runs, *run)
+	}
+	return runs
+}
+
+func (s *Service) addSchedule(schedule *types.Schedule, start time.Time) (*types.Schedule, error) {
+	rec, err := parseRecurrence(schedule.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if start.IsZero() {
+		start = s.currentTime()
+	}
+	schedule.NextRun = start
+	if _, ok := rec.(cron); ok {
+		schedule.NextRun = rec.next(start, start)
+	}
+	schedule.Start = schedule.NextRun
+
+	schedule.ID = uuid.New().String()
+	schedule.Active = !schedule.NextRun.IsZero()
+	s.schedules = append(s.schedules, schedule)
+	return schedule, nil
+}
+
+// runSchedule pays the schedule, it was authorized when it was created
+func (s *Service) runSchedule(schedule *types.Schedule) (*types.Payment, error) {
+	if schedule.FavoriteID != "" {
+		return s.payFromFavorite(schedule.FavoriteID, nil, preauthorized)
+	}
+	return s.pay(schedule.AccountID, schedule.Amount, schedule.Category, nil, "", preauthorized)
+}
+
+// advanceSchedule moves the schedule to its first run after now, missed runs are skipped
+func (s *Service) advanceSchedule(schedule *types.Schedule, now time.Time) {
+	rec, err := parseRecurrence(schedule.Spec)
+	if err != nil {
+		schedule.Active = false
+		return
+	}
+	for !schedule.NextRun.After(now) {
+		schedule.NextRun = rec.next(schedule.Start, schedule.NextRun)
+		if schedule.NextRun.IsZero() {
+			schedule.Active = false
+			return
+		}
+	}
+}
+
+// scheduleRecords converts schedules to dump records, times are unix seconds
+func (s *Service) scheduleRecords() [][]string {
+	records := make([][]string, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		records = append(records, []string{
+			schedule.ID,
+			strconv.FormatInt(schedule.AccountID, 10),
+			schedule.FavoriteID,
+			strconv.FormatInt(int64(schedule.Amount), 10),
+			string(schedule.Category),
+			schedule.Spec,
+			strconv.FormatInt(schedule.NextRun.Unix(), 10),
+			strconv.FormatInt(schedule.RetryAt.Unix(), 10),
+			strconv.Itoa(schedule.Attempts),
+			strconv.FormatBool(schedule.Active),
+			strconv.FormatInt(schedule.Start.Unix(), 10),
+		})
+	}
+	return records
+}
+
+// importSchedules restores schedules from dump records
+func (s *Service) importSchedules(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 10 {
+			return fmt.Errorf("schedule record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		nextRun, err := strconv.ParseInt(record[6], 10, 64)
+		if err != nil {
+			return err
+		}
+		retryAt, err := strconv.ParseInt(record[7], 10, 64)
+		if err != nil {
+			return err
+		}
+		attempts, err := strconv.Atoi(record[8])
+		if err != nil {
+			return err
+		}
+		active, err := strconv.ParseBool(record[9])
+		if err != nil {
+			return err
+		}
+		// schedules dumped without start keep the day of their next run
+		start := nextRun
+		if len(record) > 10 {
+			if start, err = strconv.ParseInt(record[10], 10, 64); err != nil {
+				return err
+			}
+		}
+		s.schedules = append(s.schedules, &types.Schedule{
+			ID:         record[0],
+			AccountID:  accountID,
+			FavoriteID: record[2],
+			Amount:     types.Money(amount),
+			Category:   types.PaymentCategory(record[4]),
+			Spec:       record[5],
+			Start:      time.Unix(start, 0),
+			NextRun:    time.Unix(nextRun, 0),
+			RetryAt:    time.Unix(retryAt, 0),
+			Attempts:   attempts,
+			Active:     active,
+		})
+	}
+	return nil
+}
+
+// scheduleRunRecords converts history of schedule runs to dump records,
+// errors are escaped because they may have ;
+func (s *Service) scheduleRunRecords() [][]string {
+	records := make([][]string, 0, len(s.scheduleRuns))
+	for _, run := range s.scheduleRuns {
+		records = append(records, []string{
+			run.ScheduleID,
+			strconv.FormatInt(run.Time.Unix(), 10),
+			run.PaymentID,
+			string(run.Status),
+			url.PathEscape(run.Error),
+		})
+	}
+	return records
+}
+
+// importScheduleRuns restores history of schedule runs from dump records
+func (s *Service) importScheduleRuns(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("schedule run record has %d fields", len(record))
+		}
+		runTime, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		runError, err := url.PathUnescape(record[4])
+		if err != nil {
+			return err
+		}
+		s.scheduleRuns = append(s.scheduleRuns, &types.ScheduleRun{
+			ScheduleID: record[0],
+			Time:       time.Unix(runTime, 0),
+			PaymentID:  record[2],
+			Status:     types.ScheduleRunStatus(record[3]),
+			Error:      runError,
+		})
+	}
+	return nil
+}
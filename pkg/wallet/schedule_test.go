@@ -0,0 +1,210 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+func TestService_RunDueSchedules_favorite(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, payments, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	favorite, err := s.FavoritePayment(payments[0].ID, "internet")
+	if err != nil {
+		t.Errorf("FavoritePayment(): error = %v", err)
+		return
+	}
+
+	schedule, err := s.ScheduleFavorite(favorite.ID, "@monthly", now)
+	if err != nil {
+		t.Errorf("ScheduleFavorite(): error = %v", err)
+		return
+	}
+
+	runs := s.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunOk {
+		t.Errorf("RunDueSchedules(): wrong runs = %v", runs)
+		return
+	}
+	if account.Balance != 8_000_00 {
+		t.Errorf("RunDueSchedules(): wrong balance = %v", account.Balance)
+	}
+
+	now = now.AddDate(0, 0, 15)
+	if runs := s.RunDueSchedules(); len(runs) != 0 {
+		t.Errorf("RunDueSchedules(): must not run before next month, runs = %v", runs)
+	}
+
+	now = time.Date(2021, 2, 1, 9, 0, 0, 0, time.UTC)
+	if runs := s.RunDueSchedules(); len(runs) != 1 {
+		t.Errorf("RunDueSchedules(): must run next month, runs = %v", runs)
+	}
+	if len(s.ScheduleRuns(schedule.ID)) != 2 {
+		t.Errorf("ScheduleRuns(): wrong count = %v", len(s.ScheduleRuns(schedule.ID)))
+	}
+}
+
+func TestService_RunDueSchedules_retry(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	s.SetScheduleRetry(1, time.Hour)
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	schedule, err := s.SchedulePayment(account.ID, 20_000_00, "rent", "@daily", now)
+	if err != nil {
+		t.Errorf("SchedulePayment(): error = %v", err)
+		return
+	}
+
+	runs := s.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunRetry {
+		t.Errorf("RunDueSchedules(): must retry, runs = %v", runs)
+		return
+	}
+	if !schedule.RetryAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("RunDueSchedules(): wrong retry time = %v", schedule.RetryAt)
+	}
+
+	now = now.Add(time.Hour)
+	runs = s.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunFail {
+		t.Errorf("RunDueSchedules(): must fail after retries, runs = %v", runs)
+		return
+	}
+	if !schedule.NextRun.Equal(time.Date(2021, 1, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("RunDueSchedules(): wrong next run = %v", schedule.NextRun)
+	}
+}
+
+func TestService_SchedulePayment_cron(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	schedule, err := s.SchedulePayment(account.ID, 10_00, "mobile", "30 8 * * 1-5", time.Time{})
+	if err != nil {
+		t.Errorf("SchedulePayment(): error = %v", err)
+		return
+	}
+	// 2021-01-01 is friday, so the next weekday is monday 2021-01-04
+	if !schedule.NextRun.Equal(time.Date(2021, 1, 4, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("SchedulePayment(): wrong next run = %v", schedule.NextRun)
+	}
+
+	_, err = s.SchedulePayment(account.ID, 10_00, "mobile", "61 * * * *", time.Time{})
+	if err == nil {
+		t.Error("SchedulePayment(): must return error for invalid spec, returned nil")
+	}
+}
+
+func TestService_SchedulePayment_monthlyEnd(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	schedule, err := s.SchedulePayment(account.ID, 10_00, "rent", "@monthly", now)
+	if err != nil {
+		t.Errorf("SchedulePayment(): error = %v", err)
+		return
+	}
+
+	// the day of start is kept after short months
+	for _, want := range []time.Time{
+		time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 4, 30, 9, 0, 0, 0, time.UTC),
+	} {
+		s.RunDueSchedules()
+		if !schedule.NextRun.Equal(want) {
+			t.Errorf("RunDueSchedules(): next run = %v, want %v", schedule.NextRun, want)
+			return
+		}
+		now = want
+	}
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	imported.SetClock(func() time.Time { return now })
+	imported.RunDueSchedules()
+	if next := imported.schedules[0].NextRun; !next.Equal(time.Date(2021, 5, 31, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Import(): next run = %v", next)
+	}
+}
+
+func TestService_Export_schedules(t *testing.T) {
+	s := newTestService()
+	now := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+	s.SetScheduleRetry(1, time.Hour)
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	schedule, _ := s.SchedulePayment(account.ID, 20_000_00, "rent", "@daily", now)
+	s.RunDueSchedules()
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	imported.SetClock(func() time.Time { return now })
+	imported.SetScheduleRetry(1, time.Hour)
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	found, err := imported.FindScheduleByID(schedule.ID)
+	if err != nil || !found.RetryAt.Equal(schedule.RetryAt) || found.Attempts != 1 || !found.Active || found.Spec != "@daily" {
+		t.Errorf("Import(): schedule = %+v, error = %v", found, err)
+		return
+	}
+	if runs := imported.ScheduleRuns(schedule.ID); len(runs) != 1 || runs[0].Error != s.ScheduleRuns(schedule.ID)[0].Error {
+		t.Errorf("Import(): runs = %+v", runs)
+	}
+
+	// imported schedule goes on from its retry
+	now = now.Add(time.Hour)
+	runs := imported.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunFail {
+		t.Errorf("RunDueSchedules(): must fail after retries, runs = %v", runs)
+	}
+	if !found.NextRun.Equal(time.Date(2021, 1, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("RunDueSchedules(): wrong next run = %v", found.NextRun)
+	}
+}
@@ -1,10 +1,10 @@
 package wallet
 
 import (
+	"context"
 	"errors"
 	"io"
 	//"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -12,6 +12,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/siavash-art/wallet/pkg/types"
 	"sync"
+	"time"
 )
 
 var ErrPhoneRegistered = errors.New("phone already registered")
@@ -27,31 +28,85 @@ type Service struct {
 	nextAccountID int64
 	accounts      []*types.Account
 	payments      []*types.Payment
+	paymentIndex  *paymentIndex
 	favorites     []*types.Favorite
+	refunds       []*types.Refund
+	holds         []*types.Hold
+	holdTTL       time.Duration
+	schedules     []*types.Schedule
+	scheduleRuns  []*types.ScheduleRun
+	scheduleRetry *retryPolicy
+	codeSender    CodeSender
+	phoneChanges  map[int64]*phoneChange
+	phoneHistory  []*types.PhoneChange
+	credentials   map[int64]*credential
+	authThreshold types.Money
+	maxPayment    types.Money
+	maxDeposit    types.Money
+	feeRules      []types.FeeRule
+	categories    []*types.Category
+	merchants     []*types.Merchant
+	settlements   []*types.Settlement
+	budgets       []*types.Budget
+	budgetAlerts  BudgetNotifier
+	actor         string
+	auditLog      []*types.AuditRecord
+	logger        Logger
+	now           func() time.Time
 }
 
-// RegisterAccount asdasd asdasd
-func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error) {
+// SetClock sets the time source used by the service
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// currentTime returns the time of the service clock
+func (s *Service) currentTime() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// RegisterAccount registers account with phone normalized to E.164
+func (s *Service) RegisterAccount(phone types.Phone) (account *types.Account, err error) {
+	defer wrapError(&err, "RegisterAccount", 0, "")
+
+	audit := s.startAudit("RegisterAccount", 0, 0, phone)
+	defer audit.finish(&err)
+
+	phone, err = NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
 	for _, account := range s.accounts {
 		if account.Phone == phone {
 			return nil, ErrPhoneRegistered
 		}
 	}
 	s.nextAccountID++
-	account := &types.Account{
+	account = &types.Account{
 		ID:      s.nextAccountID,
 		Phone:   phone,
 		Balance: 0,
+		Status:  types.AccountStatusActive,
 	}
 	s.accounts = append(s.accounts, account)
+	audit.accountID = account.ID
 	return account, nil
 }
 
 // Deposit balance
-func (s *Service) Deposit(AccountID int64, amount types.Money) error {
+func (s *Service) Deposit(AccountID int64, amount types.Money) (err error) {
+	defer wrapError(&err, "Deposit", AccountID, "")
+	defer s.startAudit("Deposit", AccountID, 0, amount).finish(&err)
+
 	if amount <= 0 {
 		return ErrAmountMustBePositive
 	}
+	if s.maxDeposit != 0 && amount > s.maxDeposit {
+		return ErrLimitExceeded
+	}
 
 	var account *types.Account
 
@@ -64,16 +119,43 @@ func (s *Service) Deposit(AccountID int64, amount types.Money) error {
 	if account == nil {
 		return ErrAccountNotFound
 	}
+	err = checkAccountStatus(account)
+	if err != nil {
+		return err
+	}
 
 	account.Balance += amount
 	return nil
 }
 
-// Pay users payments
+// Pay users payments, accounts with credential must use PayWithCredential
+// for amounts above the auth threshold
 func (s *Service) Pay(accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	return s.pay(accountID, amount, category, nil, "", nil)
+}
+
+// pay checks credential if it is given or required and makes payment,
+// amount of payment to merchant is credited to merchant. Payment from
+// favorite has favoriteID from the start, so it is indexed with it
+func (s *Service) pay(accountID int64, amount types.Money, category types.PaymentCategory, merchant *types.Merchant, favoriteID string, auth *types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "Pay", accountID, "")
+	defer s.startAudit("Pay", accountID, 0, amount, category).finish(&err)
+	defer func() {
+		if err != nil {
+			s.log().Warn("payment failed", "account_id", accountID, "amount", amount, "category", category, "error", err)
+		}
+	}()
+
 	if amount <= 0 {
 		return nil, ErrAmountMustBePositive
 	}
+	if s.maxPayment != 0 && amount > s.maxPayment {
+		return nil, ErrLimitExceeded
+	}
+	category, err = s.resolveCategory(category)
+	if err != nil {
+		return nil, err
+	}
 	var account *types.Account
 	for _, acc := range s.accounts {
 		if acc.ID == accountID {
@@ -84,27 +166,52 @@ func (s *Service) Pay(accountID int64, amount types.Money, category types.Paymen
 	if account == nil {
 		return nil, ErrAccountNotFound
 	}
-	if account.Balance < amount {
+	err = checkAccountStatus(account)
+	if err != nil {
+		return nil, err
+	}
+	err = s.authorizeOperation(accountID, auth, amount > s.authThreshold)
+	if err != nil {
+		return nil, err
+	}
+	s.expireHolds()
+	fee := s.fee(amount, category)
+	if account.Available() < amount+fee {
 		return nil, ErrNotEnoughBalance
 	}
+	spent, err := s.checkBudget(accountID, category, s.heldAmount(accountID, category)+amount)
+	if err != nil {
+		return nil, err
+	}
 
-	account.Balance -= amount
+	account.Balance -= amount + fee
 
 	paymentID := uuid.New().String()
 
-	payment := &types.Payment{
-		ID:        paymentID,
-		AccountID: accountID,
-		Amount:    amount,
-		Category:  category,
-		Status:    types.PaymentStatusInProgress,
+	payment = &types.Payment{
+		ID:         paymentID,
+		AccountID:  accountID,
+		Amount:     amount,
+		Category:   category,
+		Status:     types.PaymentStatusInProgress,
+		Fee:        fee,
+		CreatedAt:  s.currentTime(),
+		FavoriteID: favoriteID,
+	}
+	if merchant != nil {
+		payment.MerchantID = merchant.ID
+		merchant.Balance += amount
+		s.log().Info("merchant credited", "merchant_id", merchant.ID, "payment_id", payment.ID, "amount", amount)
 	}
 	s.payments = append(s.payments, payment)
+	s.log().Info("payment created", "account_id", accountID, "payment_id", payment.ID, "amount", amount, "category", category)
+	s.alertBudget(payment, spent)
 	return payment, nil
 }
 
 // FindAccountByID find account by id
-func (s *Service) FindAccountByID(accountID int64) (*types.Account, error) {
+func (s *Service) FindAccountByID(accountID int64) (found *types.Account, err error) {
+	defer wrapError(&err, "FindAccountByID", accountID, "")
 
 	var account *types.Account
 
@@ -123,7 +230,8 @@ func (s *Service) FindAccountByID(accountID int64) (*types.Account, error) {
 }
 
 // FindPaymentByID find payment by account id
-func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
+func (s *Service) FindPaymentByID(paymentID string) (found *types.Payment, err error) {
+	defer wrapError(&err, "FindPaymentByID", 0, paymentID)
 
 	for _, payment := range s.payments {
 		if payment.ID == paymentID {
@@ -135,7 +243,14 @@ func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
 }
 
 // Reject changes the payment status to PaymentStatusFail
-func (s *Service) Reject(paymentID string) error {
+func (s *Service) Reject(paymentID string) (err error) {
+	defer wrapError(&err, "Reject", s.accountOfPayment(paymentID), paymentID)
+	defer s.startAudit("Reject", s.accountOfPayment(paymentID), 0, paymentID).finish(&err)
+	defer func() {
+		if err != nil {
+			s.log().Warn("reject failed", "payment_id", paymentID, "error", err)
+		}
+	}()
 
 	payment, err := s.FindPaymentByID(paymentID)
 
@@ -149,21 +264,49 @@ func (s *Service) Reject(paymentID string) error {
 		return err
 	}
 
+	if payment.Status == types.PaymentStatusFail {
+		return nil
+	}
+	if account, err = s.creditedAccount(account); err != nil {
+		return err
+	}
+
+	refunded := payment.Amount + payment.Fee - s.refundedAmount(payment.ID)
 	payment.Status = types.PaymentStatusFail
-	account.Balance += payment.Amount
+	account.Balance += refunded
+	s.debitMerchant(payment, refunded-payment.Fee)
+	s.log().Info("payment rejected", "account_id", account.ID, "payment_id", payment.ID, "refunded", refunded)
 
 	return nil
 }
 
-// Repeat repeat payment
+// Repeat repeat payment, accounts with credential must use RepeatWithCredential
+// for amounts above the auth threshold
 func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
+	return s.repeat(paymentID, nil)
+}
+
+// RepeatWithCredential repeats payment confirmed by credential
+func (s *Service) RepeatWithCredential(paymentID string, auth types.Credential) (pay *types.Payment, err error) {
+	defer wrapError(&err, "RepeatWithCredential", s.accountOfPayment(paymentID), paymentID)
+
+	return s.repeat(paymentID, &auth)
+}
+
+func (s *Service) repeat(paymentID string, auth *types.Credential) (pay *types.Payment, err error) {
+	defer wrapError(&err, "Repeat", s.accountOfPayment(paymentID), paymentID)
+	defer s.startAudit("Repeat", s.accountOfPayment(paymentID), 0, paymentID).finish(&err)
 
 	payment, err := s.FindPaymentByID(paymentID)
 	if err != nil {
 		return nil, err
 	}
 
-	pay, err := s.Pay(payment.AccountID, payment.Amount, payment.Category)
+	if payment.MerchantID != "" {
+		pay, err = s.payMerchant(payment.AccountID, payment.MerchantID, payment.Amount, auth)
+	} else {
+		pay, err = s.pay(payment.AccountID, payment.Amount, payment.Category, nil, "", auth)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -171,8 +314,15 @@ func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
 	return pay, nil
 }
 
-//FavoritePayment adddddd
+//FavoritePayment creates favorite from payment, accounts with credential
+//must use FavoritePaymentWithCredential
 func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorite, error) {
+	return s.favoritePayment(paymentID, name, nil)
+}
+
+func (s *Service) favoritePayment(paymentID string, name string, auth *types.Credential) (newFavorite *types.Favorite, err error) {
+	defer wrapError(&err, "FavoritePayment", s.accountOfPayment(paymentID), paymentID)
+	defer s.startAudit("FavoritePayment", s.accountOfPayment(paymentID), 0, paymentID, name).finish(&err)
 
 	payment, err := s.FindPaymentByID(paymentID)
 
@@ -180,14 +330,28 @@ func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorit
 		return nil, err
 	}
 
+	err = s.authorizeOperation(payment.AccountID, auth, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkFavoriteName(payment.AccountID, "", name)
+	if err != nil {
+		return nil, err
+	}
+	category, err := s.resolveCategory(payment.Category)
+	if err != nil {
+		return nil, err
+	}
+
 	genID := uuid.New().String()
 
-	newFavorite := &types.Favorite{
+	newFavorite = &types.Favorite{
 		ID:        genID,
 		AccountID: payment.AccountID,
 		Name:      name,
 		Amount:    payment.Amount,
-		Category:  payment.Category,
+		Category:  category,
 	}
 
 	s.favorites = append(s.favorites, newFavorite)
@@ -195,7 +359,8 @@ func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorit
 	return newFavorite, nil
 }
 
-func (s *Service) FindFavoriteByID(favoriteID string) (*types.Favorite, error) {
+func (s *Service) FindFavoriteByID(favoriteID string) (found *types.Favorite, err error) {
+	defer wrapError(&err, "FindFavoriteByID", 0, "")
 
 	for _, favorite := range s.favorites {
 
@@ -207,34 +372,71 @@ func (s *Service) FindFavoriteByID(favoriteID string) (*types.Favorite, error) {
 
 }
 
-// PayFromFavorite pay from favorite
+// PayFromFavorite pay from favorite, accounts with credential must use
+// PayFromFavoriteWithCredential for amounts above the auth threshold
 func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
+	return s.payFromFavorite(favoriteID, nil, nil)
+}
+
+// PayFromFavoriteWithCredential pays from favorite confirmed by credential
+func (s *Service) PayFromFavoriteWithCredential(favoriteID string, auth types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "PayFromFavoriteWithCredential", s.accountOfFavorite(favoriteID), "")
+
+	return s.payFromFavorite(favoriteID, nil, &auth)
+}
+
+// PayFromFavoriteAmount pay from favorite the amount instead of favorite
+// amount, it must be in favorite range
+func (s *Service) PayFromFavoriteAmount(favoriteID string, amount types.Money) (*types.Payment, error) {
+	return s.payFromFavorite(favoriteID, &amount, nil)
+}
+
+// PayFromFavoriteAmountWithCredential pays amount from favorite confirmed by credential
+func (s *Service) PayFromFavoriteAmountWithCredential(favoriteID string, amount types.Money, auth types.Credential) (payment *types.Payment, err error) {
+	defer wrapError(&err, "PayFromFavoriteAmountWithCredential", s.accountOfFavorite(favoriteID), "")
+
+	return s.payFromFavorite(favoriteID, &amount, &auth)
+}
+
+// payFromFavorite pays amount, or favorite amount when it is nil, in favorite
+// category and links payment to favorite
+func (s *Service) payFromFavorite(favoriteID string, amount *types.Money, auth *types.Credential) (payment *types.Payment, err error) {
+	args := []interface{}{favoriteID}
+	if amount != nil {
+		args = append(args, *amount)
+	}
+	defer wrapError(&err, "PayFromFavorite", s.accountOfFavorite(favoriteID), "")
+	defer s.startAudit("PayFromFavorite", s.accountOfFavorite(favoriteID), 0, args...).finish(&err)
 
 	favorite, err := s.FindFavoriteByID(favoriteID)
 	if err != nil {
 		return nil, err
 	}
 
-	payment, err := s.Pay(favorite.AccountID, favorite.Amount, favorite.Category)
-	if err != nil {
-		return nil, err
+	sum := favorite.Amount
+	if amount != nil {
+		sum = *amount
+	}
+	if !favoriteAllows(favorite, sum) {
+		return nil, ErrAmountOutOfRange
 	}
 
-	return payment, nil
+	return s.pay(favorite.AccountID, sum, favorite.Category, nil, favorite.ID, auth)
 }
 
 // ExportToFile exports accounts to file
-func (s *Service) ExportToFile(path string) error {
+func (s *Service) ExportToFile(path string) (err error) {
+	defer wrapError(&err, "ExportToFile", 0, "")
 
 	file, err := os.Create(path)
 	if err != nil {
-		log.Print(err)
-		return ErrFileNotFound
+		s.log().Error("export failed", "path", path, "error", err)
+		return ioError(err)
 	}
 
 	defer func() {
 		if err2 := file.Close(); err2 != nil {
-			log.Print(err2)
+			s.log().Warn("close failed", "path", path, "error", err2)
 		}
 	}()
 
@@ -243,35 +445,39 @@ func (s *Service) ExportToFile(path string) error {
 	for _, account := range s.accounts {
 		ID := strconv.Itoa(int(account.ID)) + ";"
 		phone := string(account.Phone) + ";"
-		balance := strconv.Itoa(int(account.Balance))
+		balance := strconv.Itoa(int(account.Balance)) + ";"
+		status := string(account.Status)
 
 		list += ID
 		list += phone
-		list += balance + "|"
+		list += balance
+		list += status + "|"
 	}
 
 	_, err = file.Write([]byte(list))
 
 	if err != nil {
-		log.Print()
-		return ErrFileNotFound
+		s.log().Error("export failed", "path", path, "error", err)
+		return ioError(err)
 	}
 
 	return nil
 }
 
 // ImportFromFile import accounts from file
-func (s *Service) ImportFromFile(path string) error {
+func (s *Service) ImportFromFile(path string) (err error) {
+	defer wrapError(&err, "ImportFromFile", 0, "")
+	defer s.startAudit("ImportFromFile", 0, 0, path).finish(&err)
 
 	file, err := os.Open(path)
 	if err != nil {
-		log.Print(err)
-		return ErrFileNotFound
+		s.log().Error("import failed", "path", path, "error", err)
+		return ioError(err)
 	}
 
 	defer func() {
 		if err2 := file.Close(); err2 != nil {
-			log.Print(err2)
+			s.log().Warn("close failed", "path", path, "error", err2)
 		}
 	}()
 
@@ -285,8 +491,8 @@ func (s *Service) ImportFromFile(path string) error {
 		}
 
 		if err != nil {
-			log.Print(err)
-			return ErrFileNotFound
+			s.log().Error("import failed", "path", path, "error", err)
+			return ioError(err)
 		}
 		content = append(content, buf[:read]...)
 	}
@@ -302,350 +508,371 @@ func (s *Service) ImportFromFile(path string) error {
 
 		id, err := strconv.Atoi(value[0])
 		if err != nil {
-			return err
+			return dumpError(path, err)
 		}
 
 		phone := types.Phone(value[1])
 
 		balance, err := strconv.Atoi(value[2])
 		if err != nil {
-			return err
+			return dumpError(path, err)
 		}
 
 		acc := &types.Account{
 			ID:      int64(id),
 			Phone:   phone,
 			Balance: types.Money(balance),
+			Status:  types.AccountStatusActive,
+		}
+		if len(value) > 3 && value[3] != "" {
+			acc.Status = types.AccountStatus(value[3])
+		}
+		if normalized, err := NormalizePhone(acc.Phone); err == nil {
+			acc.Phone = normalized
+		}
+		if acc.ID > s.nextAccountID {
+			s.nextAccountID = acc.ID
 		}
 
 		s.accounts = append(s.accounts, acc)
-		log.Print(account)
+		s.log().Debug("account imported", "account_id", acc.ID)
 	}
 	return nil
 }
 
 // Export all methods
 func (s *Service) Export(dir string) error {
-	if len(s.accounts) != 0 {
-		
-		accountsDir, err := os.Create(dir + "/accounts.dump")
+	return s.ExportContext(context.Background(), dir)
+}
+
+// ExportContext exports like Export, it stops before the next dump file when
+// ctx is done. Dumps are written to temporary files of dir and renamed over
+// the old ones after all are written, other files of dir are kept
+func (s *Service) ExportContext(ctx context.Context, dir string) (err error) {
+	defer wrapError(&err, "Export", 0, "")
+	defer func() {
 		if err != nil {
-			log.Println(err)
-			return ErrFileNotFound
+			s.log().Error("export failed", "dir", dir, "error", err)
+			return
 		}
-		defer func() {
-			if cerr := accountsDir.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		accList := ""
+		s.log().Info("export finished", "dir", dir, "accounts", len(s.accounts), "payments", len(s.payments), "favorites", len(s.favorites))
+	}()
 
-		for _, account := range s.accounts {
-			ID := fmt.Sprint(account.ID) + ";"
-			phone := fmt.Sprint(account.Phone) + ";"
-			balance := fmt.Sprint(account.Balance)
-			accList += ID
-			accList += phone
-			accList += balance + "\n"
-		}
-		_, err = accountsDir.WriteString(accList)
-		if err != nil {
-			return  err
+	sources := []struct {
+		name    string
+		records func() [][]string
+	}{
+		{"accounts.dump", s.accountRecords},
+		{"payments.dump", s.paymentRecords},
+		{"favorites.dump", s.favoriteRecords},
+		{"refunds.dump", s.refundRecords},
+		{"holds.dump", s.holdRecords},
+		{"schedules.dump", s.scheduleRecords},
+		{"schedule_runs.dump", s.scheduleRunRecords},
+		{"phones.dump", s.phoneHistoryRecords},
+		{"credentials.dump", s.credentialRecords},
+		{"categories.dump", s.categoryRecords},
+		{"merchants.dump", s.merchantRecords},
+		{"settlements.dump", s.settlementRecords},
+		{"budgets.dump", s.budgetRecords},
+		{"audit.dump", s.auditRecords},
+	}
+	dumps := []dumpFile{}
+	for _, source := range sources {
+		if err = ctx.Err(); err != nil {
+			return err
 		}
+		dumps = append(dumps, dumpFile{name: source.name, records: source.records()})
+	}
+	if err = ctx.Err(); err != nil {
+		return err
 	}
+	return replaceDumps(dir, dumps)
+}
 
-	//export payment
-	if len(s.payments) != 0 {
-		
-		paymentsDir, err := os.Create(dir + "/payments.dump")
-		if err != nil {
-			log.Println(err)
-			return ErrFileNotFound
-		}
-		defer func() {
-			if cerr := paymentsDir.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		paymentList := ""
-
-		for _, payment := range s.payments {
-			ID := fmt.Sprint(payment.ID) + ";"
-			accountID := fmt.Sprint(payment.AccountID) + ";"
-			amount := fmt.Sprint(payment.Amount) + ";"
-			category := fmt.Sprint(payment.Category) + ";"
-			status := fmt.Sprint(payment.Status)
-			paymentList += ID
-			paymentList += accountID
-			paymentList += amount
-			paymentList += category
-			paymentList += status + "\n"
-		}
-		_, err = paymentsDir.WriteString(paymentList)
+// Import all files
+func (s *Service) Import(dir string) error {
+	return s.ImportContext(context.Background(), dir)
+}
+
+// ImportContext imports like Import, it stops before the next dump file when
+// ctx is done. All dumps are parsed before the service is changed, so failed
+// import adds nothing
+func (s *Service) ImportContext(ctx context.Context, dir string) (err error) {
+	defer wrapError(&err, "Import", 0, "")
+	defer s.startAudit("Import", 0, 0, dir).finish(&err)
+	defer func() {
 		if err != nil {
-			return  err
+			s.log().Error("import failed", "dir", dir, "error", err)
+			return
 		}
-	}
+		s.log().Info("import finished", "dir", dir, "accounts", len(s.accounts), "payments", len(s.payments), "favorites", len(s.favorites))
+	}()
 
-	//export favorites
-	if len(s.favorites) != 0 {
-		favoritesDir, err := os.Create(dir + "/favorites.dump")
+	loaded := &Service{logger: s.logger}
+	targets := []struct {
+		name  string
+		parse func(records [][]string) error
+	}{
+		{"accounts.dump", loaded.importAccounts},
+		{"payments.dump", loaded.importPayments},
+		{"favorites.dump", loaded.importFavorites},
+		{"refunds.dump", loaded.importRefunds},
+		{"holds.dump", loaded.importHolds},
+		{"schedules.dump", loaded.importSchedules},
+		{"schedule_runs.dump", loaded.importScheduleRuns},
+		{"phones.dump", loaded.importPhoneHistory},
+		{"credentials.dump", loaded.importCredentials},
+		{"categories.dump", loaded.importCategories},
+		{"merchants.dump", loaded.importMerchants},
+		{"settlements.dump", loaded.importSettlements},
+		{"budgets.dump", loaded.importBudgets},
+		{"audit.dump", loaded.importAudit},
+	}
+	for _, target := range targets {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		path := dir + "/" + target.name
+		records, err := readDump(path)
 		if err != nil {
-			log.Println(err)
-			return ErrFileNotFound
+			return err
 		}
-		defer func() {
-			if cerr := favoritesDir.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()		
-
-		favoriteList := ""
-
-		for _, favorite := range s.favorites {
-			ID := fmt.Sprint(favorite.ID) + ";"
-			accountID := fmt.Sprint(favorite.AccountID) + ";"
-			name := fmt.Sprint(favorite.Name) + ";"
-			amount := fmt.Sprint(favorite.Amount) + ";"
-			category := fmt.Sprint(favorite.Category)
-			favoriteList += ID
-			favoriteList += accountID
-			favoriteList += name
-			favoriteList += amount
-			favoriteList += category + "\n"
+		if records == nil {
+			s.log().Debug("dump skipped", "path", path)
 		}
-		
-		_, err = favoritesDir.WriteString(favoriteList)
-		if err != nil {
-			return  err
+		if err = target.parse(records); err != nil {
+			return dumpError(path, err)
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	s.commitImport(loaded)
 	return nil
 }
 
-// Import all files
-func (s *Service) Import(dir string) error {
-
-	accountsFile, err := os.Open(dir + "/accounts.dump")
-	if err != nil {
-		log.Print(err)
-		err = ErrFileNotFound
+// commitImport adds everything parsed by import to the service, audit log
+// is restored only to service without one, so its hash chain stays unbroken
+func (s *Service) commitImport(loaded *Service) {
+	if loaded.nextAccountID > s.nextAccountID {
+		s.nextAccountID = loaded.nextAccountID
+	}
+	s.accounts = append(s.accounts, loaded.accounts...)
+	s.payments = append(s.payments, loaded.payments...)
+	s.paymentIndex = nil
+	s.favorites = append(s.favorites, loaded.favorites...)
+	s.refunds = append(s.refunds, loaded.refunds...)
+	s.holds = append(s.holds, loaded.holds...)
+	s.schedules = append(s.schedules, loaded.schedules...)
+	s.scheduleRuns = append(s.scheduleRuns, loaded.scheduleRuns...)
+	s.phoneHistory = append(s.phoneHistory, loaded.phoneHistory...)
+	for accountID, c := range loaded.credentials {
+		if s.credentials == nil {
+			s.credentials = map[int64]*credential{}
+		}
+		s.credentials[accountID] = c
+	}
+	s.categories = append(s.categories, loaded.categories...)
+	s.merchants = append(s.merchants, loaded.merchants...)
+	s.settlements = append(s.settlements, loaded.settlements...)
+	s.budgets = append(s.budgets, loaded.budgets...)
+	switch {
+	case len(loaded.auditLog) == 0:
+	case len(s.auditLog) == 0:
+		s.auditLog = loaded.auditLog
+	default:
+		s.log().Warn("audit log not imported, service has its own", "records", len(loaded.auditLog))
 	}
-	if err != ErrFileNotFound {
-		defer func() {
-			if cerr := accountsFile.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
+}
 
-		content := make([]byte, 0)
-		buf := make([]byte, 1024)
+// accountRecords converts accounts to dump records
+func (s *Service) accountRecords() [][]string {
+	records := make([][]string, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		records = append(records, []string{
+			fmt.Sprint(account.ID),
+			fmt.Sprint(account.Phone),
+			fmt.Sprint(account.Balance),
+			fmt.Sprint(account.Status),
+			fmt.Sprint(account.TransferredTo),
+		})
+	}
+	return records
+}
 
-		for {
-			read, err := accountsFile.Read(buf)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return ErrFileNotFound
-			}
-			content = append(content, buf[:read]...)
+// importAccounts restores accounts from dump records, accounts without
+// status are active
+func (s *Service) importAccounts(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 3 {
+			return fmt.Errorf("account record has %d fields", len(record))
 		}
-
-		data := string(content)
-
-		accounts := strings.Split(data, "\n")
-		accounts = accounts[:len(accounts)-1]
-
-		for _, account := range accounts {
-			value := strings.Split(account, ";")
-			id, err := strconv.Atoi(value[0])
-			if err != nil {
-				return err
-			}
-			phone := types.Phone(value[1])
-			balance, err := strconv.Atoi(value[2])
-			if err != nil {
-				return err
-			}
-			acc := &types.Account{
-				ID:      int64(id),
-				Phone:   phone,
-				Balance: types.Money(balance),
-			}
-
-			s.accounts = append(s.accounts, acc)
-			log.Print(account)
+		id, err := strconv.Atoi(record[0])
+		if err != nil {
+			return err
 		}
-	}
-	//import payments.dump
-	paymentFile, err := os.Open(dir + "/payments.dump")
-	if err != nil {
-		log.Print(err)
-		err = ErrFileNotFound
-	}
-	if err != ErrFileNotFound {
-		defer func() {
-			if cerr := paymentFile.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		paymentContent := make([]byte, 0)
-		paymentBuf := make([]byte, 1024)
-
-		for {
-			read, err := paymentFile.Read(paymentBuf)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return ErrFileNotFound
-			}
-			paymentContent = append(paymentContent, paymentBuf[:read]...)
+		balance, err := strconv.Atoi(record[2])
+		if err != nil {
+			return err
 		}
-
-		paymentData := string(paymentContent)
-		payments := strings.Split(paymentData, "\n")
-		payments = payments[:len(payments)-1]
-
-		for _, payment := range payments {
-			value := strings.Split(payment, ";")
-			id := string(value[0])
-			accountID, err := strconv.Atoi(value[1])
-			if err != nil {
-				return err
-			}
-			amount, err := strconv.Atoi(value[2])
-			if err != nil {
+		account := &types.Account{
+			ID:      int64(id),
+			Phone:   types.Phone(record[1]),
+			Balance: types.Money(balance),
+			Status:  types.AccountStatusActive,
+		}
+		if len(record) > 3 && record[3] != "" {
+			account.Status = types.AccountStatus(record[3])
+		}
+		if len(record) > 4 {
+			if account.TransferredTo, err = strconv.ParseInt(record[4], 10, 64); err != nil {
 				return err
 			}
-			category := string(value[3])
-			status := string(value[4])
-
-			pay := &types.Payment{
-				ID:        string(id),
-				AccountID: int64(accountID),
-				Amount:    types.Money(amount),
-				Category:  types.PaymentCategory(category),
-				Status:    types.PaymentStatus(status),
-			}
-
-			s.payments = append(s.payments, pay)
-			log.Print(payment)
 		}
-	}
+		if normalized, err := NormalizePhone(account.Phone); err == nil {
+			account.Phone = normalized
+		}
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
 
-	//import favorites.dump
-	favoriteFile, err := os.Open(dir + "/favorites.dump")
-	if err != nil {
-		log.Print(err)
-		err = ErrFileNotFound
+		s.accounts = append(s.accounts, account)
+		s.log().Debug("account imported", "account_id", account.ID)
 	}
+	return nil
+}
 
-	if err != ErrFileNotFound {
-		defer func() {
-			if cerr := favoriteFile.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		favContent := make([]byte, 0)
-		favBuf := make([]byte, 1024)
+// paymentRecords converts payments to dump records, times are unix seconds
+func (s *Service) paymentRecords() [][]string {
+	records := make([][]string, 0, len(s.payments))
+	for _, payment := range s.payments {
+		records = append(records, []string{
+			fmt.Sprint(payment.ID),
+			fmt.Sprint(payment.AccountID),
+			fmt.Sprint(payment.Amount),
+			fmt.Sprint(payment.Category),
+			fmt.Sprint(payment.Status),
+			fmt.Sprint(payment.FavoriteID),
+			fmt.Sprint(payment.Fee),
+			fmt.Sprint(payment.CreatedAt.Unix()),
+			fmt.Sprint(payment.MerchantID),
+		})
+	}
+	return records
+}
 
-		for {
-			read, err := favoriteFile.Read(favBuf)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return ErrFileNotFound
-			}
-			favContent = append(favContent, favBuf[:read]...)
+// importPayments restores payments from dump records, fields added later
+// may be missing in older dumps
+func (s *Service) importPayments(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 5 {
+			return fmt.Errorf("payment record has %d fields", len(record))
 		}
-
-		favData := string(favContent)
-		favorites := strings.Split(favData, "\n")
-		favorites = favorites[:len(favorites)-1]
-
-		for _, favorite := range favorites {
-			value := strings.Split(favorite, ";")
-			id := string(value[0])
-			accountID, err := strconv.Atoi(value[1])
+		accountID, err := strconv.Atoi(record[1])
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.Atoi(record[2])
+		if err != nil {
+			return err
+		}
+		payment := &types.Payment{
+			ID:        record[0],
+			AccountID: int64(accountID),
+			Amount:    types.Money(amount),
+			Category:  types.PaymentCategory(record[3]),
+			Status:    types.PaymentStatus(record[4]),
+		}
+		if len(record) > 5 {
+			payment.FavoriteID = record[5]
+		}
+		if len(record) > 6 {
+			fee, err := strconv.Atoi(record[6])
 			if err != nil {
 				return err
 			}
-			name := string(value[2])
-			amount, err := strconv.Atoi(value[3])
+			payment.Fee = types.Money(fee)
+		}
+		if len(record) > 7 {
+			createdAt, err := strconv.ParseInt(record[7], 10, 64)
 			if err != nil {
 				return err
 			}
-			category := string(value[4])
-
-			favorite := &types.Favorite{
-				ID:        id,
-				AccountID: int64(accountID),
-				Name:      name,
-				Amount:    types.Money(amount),
-				Category:  types.PaymentCategory(category),
-			}
-
-			s.favorites = append(s.favorites, favorite)
-			log.Print(favorite)
+			payment.CreatedAt = time.Unix(createdAt, 0)
+		}
+		if len(record) > 8 {
+			payment.MerchantID = record[8]
 		}
+
+		s.payments = append(s.payments, payment)
+		s.log().Debug("payment imported", "account_id", payment.AccountID, "payment_id", payment.ID)
 	}
 	return nil
 }
 
-// ExportAccountHistory - export account history by account Id
- func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error) {
-	var payments []types.Payment
+// ExportAccountHistory - export account history by account Id, account without
+// payments has empty history and unknown account ErrAccountNotFound
+ func (s *Service) ExportAccountHistory(accountID int64) (history []types.Payment, err error) {
+	defer wrapError(&err, "ExportAccountHistory", accountID, "")
+
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	payments := []types.Payment{}
 	for _, payment := range s.payments {
 		if payment.AccountID == accountID {
 			payments= append(payments, *payment)
 		} 	
 	}
-	if payments == nil {		
-		return nil, ErrAccountNotFound
-	}
 	return payments, nil
  }
 
  // HistoryToFiles get payments from ExportAccountHistory and add to file
  func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records int) error {
+	return s.HistoryToFilesContext(context.Background(), payments, dir, records)
+ }
+
+ // HistoryToFilesContext writes history like HistoryToFiles and stops when ctx is done
+ func (s *Service) HistoryToFilesContext(ctx context.Context, payments []types.Payment, dir string, records int) (err error) {
+	defer wrapError(&err, "HistoryToFiles", 0, "")
 	
 	if len(payments) > 0 {
 
 		if len(payments) <= records {
-			file, _ := os.OpenFile(dir + "/payments.dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+			file, err := os.OpenFile(dir + "/payments.dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+			if err != nil {
+				return ioError(err)
+			}
 			defer func() {
 				if cerr := file.Close(); cerr != nil {
-					log.Print(cerr)
+					s.log().Warn("close failed", "path", dir+"/payments.dump", "error", cerr)
 				}
 			}()
 						
 			paymentList := ""
 
 			for _, payment := range payments {
+				if err = ctx.Err(); err != nil {
+					return err
+				}
 				ID := fmt.Sprint(payment.ID) + ";"
 				accountID := fmt.Sprint(payment.AccountID) + ";"
 				amount := fmt.Sprint(payment.Amount) + ";"
 				category := fmt.Sprint(payment.Category) + ";"
-				status := fmt.Sprint(payment.Status)
+				status := fmt.Sprint(payment.Status) + ";"
+				favoriteID := fmt.Sprint(payment.FavoriteID)
 				paymentList += ID
 				paymentList += accountID
 				paymentList += amount
 				paymentList += category
-				paymentList += status + "\n"
+				paymentList += status
+				paymentList += favoriteID + "\n"
 			}
-			_, err := file.WriteString(paymentList)
+			_, err = file.WriteString(paymentList)
 			if err != nil {
-				return  err
+				return ioError(err)
 			}
 		
 		} else {
@@ -654,18 +881,29 @@ func (s *Service) Import(dir string) error {
 			counter := 0
 			nextFile := 1
 			var file *os.File
+			defer func() {
+				if counter != 0 {
+					file.Close()
+				}
+			}()
 
 			for _, payment := range payments {
+				if err = ctx.Err(); err != nil {
+					return err
+				}
 				if counter == 0 {
-					file, _ = os.OpenFile(dir + "/payments"+fmt.Sprint(nextFile)+".dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+					file, err = os.OpenFile(dir + "/payments"+fmt.Sprint(nextFile)+".dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+					if err != nil {
+						return ioError(err)
+					}
 				}
 				counter++
 
-				paymentList = fmt.Sprint(payment.ID) + ";" + fmt.Sprint(payment.AccountID) + ";" + fmt.Sprint(payment.Amount) + ";" + fmt.Sprint(payment.Category) + ";" + fmt.Sprint(payment.Status) + "\n"
+				paymentList = fmt.Sprint(payment.ID) + ";" + fmt.Sprint(payment.AccountID) + ";" + fmt.Sprint(payment.Amount) + ";" + fmt.Sprint(payment.Category) + ";" + fmt.Sprint(payment.Status) + ";" + fmt.Sprint(payment.FavoriteID) + "\n"
 			
 				_, err := file.WriteString(paymentList)
 				if err != nil {
-					return  err
+					return ioError(err)
 				}
 				if counter == records {
 					paymentList = ""
@@ -682,162 +920,65 @@ func (s *Service) Import(dir string) error {
  
  //SumPayments  return sum of payments	
  func (s *Service) SumPayments(goroutines int) types.Money {	
-	wg := sync.WaitGroup{}	
-	mu := sync.Mutex{}	
-	sum := int64(0)
-	count := 0
-	i := 0
-	
-	if goroutines == 0 {
-		count = len(s.payments) 
-	} else {
-		count = int(len(s.payments) / goroutines)
-	}
-	for i = 0; i < goroutines-1; i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()			
-			val := int64(0)
-			payments := s.payments[index*count : (index+1)*count]
-			
-			for _, payment := range payments {
-				val += int64(payment.Amount)
-			}
+	sum, _ := s.SumPaymentsContext(context.Background(), goroutines)
+	return sum
+ }
 
-			mu.Lock()
-			sum += val
-			mu.Unlock()
-
-		}(i)
-	} 
-	wg.Add(1)
-	go func (){
-		defer wg.Done()
-		val := int64(0)
-		payments := s.payments[i*count:]
-		for _, payment := range payments {
-			val += int64(payment.Amount)
-		}
-		mu.Lock()
-		sum += val
-		mu.Unlock()
-	}()
-	
-	wg.Wait()
+ // SumPaymentsContext sums payments like SumPayments, goroutines exit when ctx is done
+ func (s *Service) SumPaymentsContext(ctx context.Context, goroutines int) (total types.Money, err error) {
+	defer wrapError(&err, "SumPayments", 0, "")
 
-	return types.Money(sum)
+	result, err := s.MapReduceContext(ctx, sumJob(nil), goroutines)
+	if result == nil {
+		return 0, err
+	}
+	return result.(types.Money), err
  } 
 
- // FilterPayments filtered payments
- func (s *Service) FilterPayments(accountID int64, goroutines int) (filtPayments []types.Payment, err error) {
-	
-	if goroutines < 2 {
-		for _, payment := range s.payments {
-			if payment.AccountID == accountID {
-				filtPayments = append(filtPayments, *payment)
-			}
-		}	
-		if filtPayments == nil {
-			return nil, ErrAccountNotFound
-		} 
-		return
-	}
-	wg := sync.WaitGroup{}	
-	mu := sync.Mutex{}	
-	max := 0
-	count := len(s.payments) / goroutines
+ // FilterPayments returns payments of account in order they were made,
+ // account without payments has empty list and unknown account ErrAccountNotFound
+ func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsContext(context.Background(), accountID, goroutines)
+ }
+
+ // FilterPaymentsContext filters like FilterPayments, goroutines exit when ctx is done
+ func (s *Service) FilterPaymentsContext(ctx context.Context, accountID int64, goroutines int) (filtPayments []types.Payment, err error) {
+	defer wrapError(&err, "FilterPayments", accountID, "")
 	
-	for i := 1; i < goroutines; i++ {
-		max += count
-		wg.Add(1)
-		go func(value int){
-			defer wg.Done()
-			sum := []types.Payment{}
-			for _, payment := range s.payments[value-count : value] {
-				if payment.AccountID == accountID {
-					sum = append(sum, *payment)
-				}
-			}
-			mu.Lock()
-			filtPayments = append(filtPayments, sum...)
-			mu.Unlock()
-		}(max)
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		sum := []types.Payment{}
-		for _, payment := range s.payments[max:] {
-			if payment.AccountID == accountID {
-				sum = append(sum, *payment)
-			}
-		}
-		mu.Lock()
-		filtPayments = append(filtPayments, sum...)
-		mu.Unlock()
-	}()
-	wg.Wait()
-	if filtPayments == nil {
-		return nil, ErrAccountNotFound
-	} 	
-	return 
+	if _, err = s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	return s.filterPayments(ctx, func(payment types.Payment) bool {
+		return payment.AccountID == accountID
+	}, goroutines)
  } 
 
- // FilterPaymentsByFn filtered payments by function
- func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, goroutines int) (filtPayments []types.Payment, err error) {
-	
-	if goroutines < 2 {
-		for _, payment := range s.payments {
-			if filter(*payment) {
-				filtPayments = append(filtPayments, *payment)
-			}
-		}	
-		if filtPayments == nil {
-			return nil, ErrAccountNotFound
-		} 
-		return
-	}
-	wg := sync.WaitGroup{}	
-	mu := sync.Mutex{}	
-	max := 0
-	count := len(s.payments) / goroutines
+ // FilterPaymentsByFn returns payments accepted by filter in order they were made,
+ // the list is empty when no payment is accepted
+ func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsByFnContext(context.Background(), filter, goroutines)
+ }
+
+ // FilterPaymentsByFnContext filters like FilterPaymentsByFn, goroutines exit when ctx is done
+ func (s *Service) FilterPaymentsByFnContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) (filtPayments []types.Payment, err error) {
+	defer wrapError(&err, "FilterPaymentsByFn", 0, "")
 	
-	for i := 1; i < goroutines; i++ {
-		max += count
-		wg.Add(1)
-		go func(value int){
-			defer wg.Done()
-			sum := []types.Payment{}
-			for _, payment := range s.payments[value-count : value] {
-				if filter(*payment) {
-					sum = append(sum, *payment)
-				}
-			}
-			mu.Lock()
-			filtPayments = append(filtPayments, sum...)
-			mu.Unlock()
-		}(max)
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		sum := []types.Payment{}
-		for _, payment := range s.payments[max:] {
-			if filter(*payment) {
-				sum = append(sum, *payment)
-			}
-		}
-		mu.Lock()
-		filtPayments = append(filtPayments, sum...)
-		mu.Unlock()
-	}()
-	wg.Wait()
-	if filtPayments == nil {
-		return nil, ErrAccountNotFound
-	} 	
-	return 
+	return s.filterPayments(ctx, filter, goroutines)
  } 
 
+ // filterPayments collects payments accepted by filter in their order,
+ // chunks of goroutines are joined in order so the result does not depend on them
+ func (s *Service) filterPayments(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) ([]types.Payment, error) {
+	result, err := s.MapReduceContext(ctx, collectJob(filter), goroutines)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []types.Payment{}, nil
+	}
+	return result.([]types.Payment), nil
+ }
+
 //Merge merge channels
  func Merge(channels []<-chan types.Progress) <-chan types.Progress {
 	wg := sync.WaitGroup{}
@@ -858,40 +999,4 @@ func (s *Service) Import(dir string) error {
 	}() 
 
 	return merged
-}
-
- // SumPaymentsWithProgress channels
- func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {	
-	wg := sync.WaitGroup{}
-	channel := make(chan types.Progress)
-	const partsMoney = 1000000
-	
-	payments := make([]types.Money, 0)	
-	for _, payment := range s.payments {
-		payments = append(payments, payment.Amount)
-	}	
-
-	parts := (len(payments)+1) / partsMoney 		
-	
-	if parts <= 0 {
-		parts = 1
-	}
-	for i := 0; i < parts; i++ {
-		wg.Add(1)		
-		go func (channel chan<- types.Progress, payments []types.Money, data int) {			
-			sum := types.Money(0)
-			defer wg.Done()			
-			for _, v := range s.payments {
-				sum += v.Amount
-			}	
-			channel <- types.Progress {
-				Result: sum,
-			} 		
-		}(channel, payments, i)
-	}
-	go func() {
-		defer close(channel)
-		wg.Wait()
-	}()
-	return channel
- }
\ No newline at end of file
+}
\ No newline at end of file
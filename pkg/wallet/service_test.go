@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"errors"
 	"log"
 	"github.com/siavash-art/wallet/pkg/types"
 	"testing"
@@ -194,7 +195,7 @@ func TestService_PayFromFavorite_success(t *testing.T) {
 	}
 	
 	
-	if err == ErrPaymentNotFound {
+	if errors.Is(err, ErrPaymentNotFound) {
 		t.Errorf("PayFromFavorite(): must return ErrFavoriteNotFound, returned = %v", err)
 		return
 	}
@@ -237,7 +238,7 @@ func TestService_FindFavoriteByID_fail(t *testing.T) {
 	}
 	
 	
-	if err != ErrFavoriteNotFound {
+	if !errors.Is(err, ErrFavoriteNotFound) {
 		t.Errorf("FindFavoriteByID(): must return ErrFavoriteNotFound, returned = %v", err)
 		return
 	}
@@ -0,0 +1,211 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siavash-art/wallet/pkg/types"
+)
+
+var ErrNoCodeSender = errors.New("code sender is not set")
+var ErrNoPhoneChange = errors.New("phone change was not requested")
+var ErrVerificationExpired = errors.New("verification code expired")
+var ErrInvalidCode = errors.New("invalid verification code")
+var ErrTooManyAttempts = errors.New("too many verification attempts")
+
+const verificationCodeTTL = 10 * time.Minute
+const verificationAttempts = 3
+
+// CodeSender delivers verification codes to phones
+type CodeSender interface {
+	SendCode(phone types.Phone, code string) error
+}
+
+// MemoryCodeSender keeps sent codes in memory, it is used in tests
+type MemoryCodeSender struct {
+	mu    sync.Mutex
+	codes map[types.Phone]string
+}
+
+// SendCode remembers the code sent to phone
+func (m *MemoryCodeSender) SendCode(phone types.Phone, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.codes == nil {
+		m.codes = map[types.Phone]string{}
+	}
+	m.codes[phone] = code
+	return nil
+}
+
+// LastCode returns the last code sent to phone
+func (m *MemoryCodeSender) LastCode(phone types.Phone) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.codes[phone]
+}
+
+// phoneChange pending change of account phone
+type phoneChange struct {
+	phone     types.Phone
+	code      string
+	expiresAt time.Time
+	attempts  int
+}
+
+// SetCodeSender sets the sender of verification codes
+func (s *Service) SetCodeSender(sender CodeSender) {
+	s.codeSender = sender
+}
+
+// RequestPhoneChange sends verification code to the new phone of account,
+// the change is applied by ConfirmPhoneChange
+func (s *Service) RequestPhoneChange(accountID int64, phone types.Phone) (err error) {
+	defer wrapError(&err, "RequestPhoneChange", accountID, "")
+	defer s.startAudit("RequestPhoneChange", accountID, 0, phone).finish(&err)
+
+	if s.codeSender == nil {
+		return ErrNoCodeSender
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	err = checkAccountStatus(account)
+	if err != nil {
+		return err
+	}
+
+	phone, err = NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+	if _, err := s.FindAccountByPhone(phone); err == nil {
+		return ErrPhoneRegistered
+	}
+
+	var code string
+	code, err = verificationCode()
+	if err != nil {
+		return err
+	}
+	err = s.codeSender.SendCode(phone, code)
+	if err != nil {
+		return err
+	}
+
+	if s.phoneChanges == nil {
+		s.phoneChanges = map[int64]*phoneChange{}
+	}
+	s.phoneChanges[accountID] = &phoneChange{
+		phone:     phone,
+		code:      code,
+		expiresAt: s.currentTime().Add(verificationCodeTTL),
+	}
+	return nil
+}
+
+// ConfirmPhoneChange changes the account phone if code is valid
+func (s *Service) ConfirmPhoneChange(accountID int64, code string) (err error) {
+	defer wrapError(&err, "ConfirmPhoneChange", accountID, "")
+	defer s.startAudit("ConfirmPhoneChange", accountID, 0).finish(&err)
+
+	change, ok := s.phoneChanges[accountID]
+	if !ok {
+		return ErrNoPhoneChange
+	}
+	if !s.currentTime().Before(change.expiresAt) {
+		delete(s.phoneChanges, accountID)
+		return ErrVerificationExpired
+	}
+	if change.code != code {
+		change.attempts++
+		if change.attempts >= verificationAttempts {
+			delete(s.phoneChanges, accountID)
+			return ErrTooManyAttempts
+		}
+		return ErrInvalidCode
+	}
+	delete(s.phoneChanges, accountID)
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.FindAccountByPhone(change.phone); err == nil {
+		return ErrPhoneRegistered
+	}
+
+	s.phoneHistory = append(s.phoneHistory, &types.PhoneChange{
+		AccountID: accountID,
+		OldPhone:  account.Phone,
+		NewPhone:  change.phone,
+		ChangedAt: s.currentTime(),
+	})
+	account.Phone = change.phone
+	return nil
+}
+
+// PhoneHistory returns previous phones of account
+func (s *Service) PhoneHistory(accountID int64) []types.PhoneChange {
+	var history []types.PhoneChange
+	for _, change := range s.phoneHistory {
+		if change.AccountID == accountID {
+			history = append(history, *change)
+		}
+	}
+	return history
+}
+
+// verificationCode generates random six digit code
+func verificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// phoneHistoryRecords converts phone history to dump records
+func (s *Service) phoneHistoryRecords() [][]string {
+	records := make([][]string, 0, len(s.phoneHistory))
+	for _, change := range s.phoneHistory {
+		records = append(records, []string{
+			strconv.FormatInt(change.AccountID, 10),
+			string(change.OldPhone),
+			string(change.NewPhone),
+			strconv.FormatInt(change.ChangedAt.Unix(), 10),
+		})
+	}
+	return records
+}
+
+// importPhoneHistory restores phone history from dump records
+func (s *Service) importPhoneHistory(records [][]string) error {
+	for _, record := range records {
+		if len(record) < 4 {
+			return fmt.Errorf("phone record has %d fields", len(record))
+		}
+		accountID, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		changedAt, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.phoneHistory = append(s.phoneHistory, &types.PhoneChange{
+			AccountID: accountID,
+			OldPhone:  types.Phone(record[1]),
+			NewPhone:  types.Phone(record[2]),
+			ChangedAt: time.Unix(changedAt, 0),
+		})
+	}
+	return nil
+}
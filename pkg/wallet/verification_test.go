@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestService_ConfirmPhoneChange_success(t *testing.T) {
+	s := newTestService()
+	sender := &MemoryCodeSender{}
+	s.SetCodeSender(sender)
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = s.RequestPhoneChange(account.ID, "+992 90 000 0001")
+	if err != nil {
+		t.Errorf("RequestPhoneChange(): error = %v", err)
+		return
+	}
+	code := sender.LastCode("+992900000001")
+	if len(code) != 6 {
+		t.Errorf("RequestPhoneChange(): wrong code sent = %q", code)
+		return
+	}
+
+	err = s.ConfirmPhoneChange(account.ID, code)
+	if err != nil {
+		t.Errorf("ConfirmPhoneChange(): error = %v", err)
+		return
+	}
+	if account.Phone != "+992900000001" {
+		t.Errorf("ConfirmPhoneChange(): wrong phone = %v", account.Phone)
+	}
+
+	history := s.PhoneHistory(account.ID)
+	if len(history) != 1 || history[0].OldPhone != defaultTestAccount.phone {
+		t.Errorf("PhoneHistory(): wrong history = %v", history)
+	}
+}
+
+func TestService_ConfirmPhoneChange_attempts(t *testing.T) {
+	s := newTestService()
+	sender := &MemoryCodeSender{}
+	s.SetCodeSender(sender)
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.RequestPhoneChange(account.ID, "+992900000001")
+	if err != nil {
+		t.Errorf("RequestPhoneChange(): error = %v", err)
+		return
+	}
+	code := sender.LastCode("+992900000001")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 1; i < verificationAttempts; i++ {
+		if err = s.ConfirmPhoneChange(account.ID, wrong); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("ConfirmPhoneChange(): must return ErrInvalidCode, returned = %v", err)
+		}
+	}
+	if err = s.ConfirmPhoneChange(account.ID, wrong); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("ConfirmPhoneChange(): must return ErrTooManyAttempts, returned = %v", err)
+	}
+	if err = s.ConfirmPhoneChange(account.ID, code); !errors.Is(err, ErrNoPhoneChange) {
+		t.Errorf("ConfirmPhoneChange(): must return ErrNoPhoneChange, returned = %v", err)
+	}
+}
+
+func TestService_ConfirmPhoneChange_expired(t *testing.T) {
+	s := newTestService()
+	sender := &MemoryCodeSender{}
+	s.SetCodeSender(sender)
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time { return now })
+
+	account, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = s.RequestPhoneChange(account.ID, "+992900000001")
+	if err != nil {
+		t.Errorf("RequestPhoneChange(): error = %v", err)
+		return
+	}
+
+	now = now.Add(verificationCodeTTL)
+	err = s.ConfirmPhoneChange(account.ID, sender.LastCode("+992900000001"))
+	if !errors.Is(err, ErrVerificationExpired) {
+		t.Errorf("ConfirmPhoneChange(): must return ErrVerificationExpired, returned = %v", err)
+	}
+}